@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+// listGameAchievementsHandler lists a game's achievements with their global
+// unlock percentages. Hidden achievements stay concealed until unlocked,
+// except for users who manage games.
+func (app *application) listGameAchievementsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Games.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	achievements, err := app.models.Achievements.GetAllForGame(int64(id), user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.userPermissions(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !permissions.Include("games:write") {
+		for _, achievement := range achievements {
+			achievement.Conceal()
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"achievements": achievements}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createAchievementHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Games.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		IconURL     string `json:"iconUrl"`
+		Hidden      bool   `json:"hidden"`
+		Points      int    `json:"points"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	achievement := &model.Achievement{
+		GameID:      int64(id),
+		Name:        input.Name,
+		Description: input.Description,
+		IconURL:     input.IconURL,
+		Hidden:      input.Hidden,
+		Points:      input.Points,
+	}
+
+	v := validator.New()
+
+	if model.ValidateAchievement(v, achievement); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Achievements.Insert(achievement)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrDuplicateAchievement):
+			v.AddError("name", "the game already has an achievement with this name")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"achievement": achievement}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showLibraryAchievementsHandler shows the user's progress in a game they
+// own or have checked out from a family member.
+func (app *application) showLibraryAchievementsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	playable, err := app.models.Library.CanPlay(user.Id, int64(id))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !playable {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	achievements, err := app.models.Achievements.GetAllForGame(int64(id), user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	progress := model.NewAchievementProgress(achievements)
+
+	for _, achievement := range achievements {
+		achievement.Conceal()
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"achievements": achievements, "progress": progress}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unlockAchievementHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	gameID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	achievementID, err := app.readIntParam(r, "aid")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	unlockedAt, created, err := app.models.Achievements.Unlock(user.Id, int64(gameID), int64(achievementID))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	unlock := struct {
+		AchievementID int64     `json:"achievementId"`
+		UnlockedAt    time.Time `json:"unlockedAt"`
+	}{int64(achievementID), unlockedAt}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	err = app.writeJSON(w, status, envelope{"unlock": unlock}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
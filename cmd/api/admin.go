@@ -0,0 +1,443 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+func (app *application) listUsersAdminHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Search    string
+		Activated *bool
+		Suspended *bool
+		Role      string
+		model.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Search = app.readString(qs, "q", "")
+	input.Activated = app.readBool(qs, "activated", v)
+	input.Suspended = app.readBool(qs, "suspended", v)
+	input.Role = app.readString(qs, "role", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAll(input.Search, input.Activated, input.Suspended, input.Role, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showUserAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	games, err := app.models.Games.GetAllOfUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	library := struct {
+		Games int     `json:"games"`
+		Value float64 `json:"value"`
+	}{}
+	for _, game := range games {
+		library.Games++
+		library.Value += game.Price
+	}
+
+	wallet, err := app.models.Users.GetWallet(user.Id)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"user":        user,
+		"library":     library,
+		"wallet":      wallet,
+		"permissions": permissions,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) activateUserAdminHandler(w http.ResponseWriter, r *http.Request) {
+	app.setUserActivated(w, r, true)
+}
+
+func (app *application) deactivateUserAdminHandler(w http.ResponseWriter, r *http.Request) {
+	app.setUserActivated(w, r, false)
+}
+
+func (app *application) setUserActivated(w http.ResponseWriter, r *http.Request, activated bool) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	user.Activated = activated
+
+	err := app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) banUserAdminHandler(w http.ResponseWriter, r *http.Request) {
+	app.suspendUser(w, r, false)
+}
+
+func (app *application) suspendUserAdminHandler(w http.ResponseWriter, r *http.Request) {
+	app.suspendUser(w, r, true)
+}
+
+// suspendUser suspends the user named in the route. Temporary suspensions
+// need an end date in the future, bans must not have one.
+func (app *application) suspendUser(w http.ResponseWriter, r *http.Request, temporary bool) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Reason string     `json:"reason"`
+		Until  *time.Time `json:"until"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Reason != "", "reason", "must be provided")
+	v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+	v.Check(user.Id != app.contextGetUser(r).Id, "user", "you cannot suspend yourself")
+	if temporary {
+		v.Check(input.Until != nil, "until", "must be provided")
+		v.Check(input.Until == nil || input.Until.After(time.Now()), "until", "must be in the future")
+	} else {
+		v.Check(input.Until == nil, "until", "must not be provided for a ban")
+	}
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.Suspend(user.Id, input.Reason, input.Until)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user successfully suspended"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unsuspendUserAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Users.Unsuspend(user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user suspension successfully lifted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resetPasswordAdminHandler locks the user out of their current password and
+// every session, and emails them a one-off token to set a new password with
+// at PUT /users/password. Nothing is changed unless email can be sent, and if
+// sending fails the token is given to the admin to pass on instead.
+func (app *application) resetPasswordAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.mailer.Configured() {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, "password reset emails can't be sent, no SMTP server is configured")
+		return
+	}
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := user.Password.SetUnusable()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Users.RevokeCredentials(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.Id, 24*time.Hour, model.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	body := "An administrator has reset the password of your account.\n\n" +
+		"Set a new password with PUT /users/password and this token within 24 hours:\n\n" +
+		token.Plaintext + "\n"
+
+	env := envelope{"message": "a password reset email has been sent to the user"}
+
+	err = app.mailer.Send(user.Email, "Reset your password", body)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"user_id": strconv.FormatInt(user.Id, 10)})
+		env = envelope{
+			"message":     "the password reset email could not be sent, pass the token on to the user",
+			"reset_token": token,
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adjustWalletAdminHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Amount float64 `json:"amount"`
+		Reason string  `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	adjustment := &model.WalletAdjustment{
+		UserID:  user.Id,
+		AdminID: app.contextGetUser(r).Id,
+		Amount:  input.Amount,
+		Reason:  input.Reason,
+	}
+
+	v := validator.New()
+
+	if model.ValidateWalletAdjustment(v, adjustment); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	wallet, err := app.models.Users.AdjustWallet(adjustment)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrInsufficientFunds):
+			v.AddError("amount", "would make the balance negative")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"wallet": wallet, "adjustment": adjustment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readUserParam loads the user named by the id route parameter and writes
+// the error response itself if that fails.
+func (app *application) readUserParam(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (app *application) restoreGameAdminHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Games.Restore(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	game, err := app.models.Games.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"game": game}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeGameAdminHandler deletes a delisted game for good, along with its
+// achievements, tags and play sessions. Games anyone owns or ordered can't
+// be purged.
+func (app *application) purgeGameAdminHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	game, err := app.models.Games.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if game.Status != model.StatusDelisted {
+		app.failedValidatorResponse(w, r, map[string]string{"game": "must be delisted before it can be purged"})
+		return
+	}
+
+	owners, err := app.models.Games.CountOwners(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if owners > 0 {
+		app.errorResponse(w, r, http.StatusConflict, fmt.Sprintf("game is owned or ordered by %d users and cannot be purged", owners))
+		return
+	}
+
+	err = app.models.Games.Purge(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrGameOwned):
+			app.errorResponse(w, r, http.StatusConflict, "game is owned or ordered and cannot be purged")
+		case errors.Is(err, model.ErrGameHasDLC):
+			app.errorResponse(w, r, http.StatusConflict, "game has DLC and cannot be purged before it")
+		case errors.Is(err, model.ErrGameIncluded):
+			app.errorResponse(w, r, http.StatusConflict, "game is included in editions or bundles and cannot be purged")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "game successfully purged"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
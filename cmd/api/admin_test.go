@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Without a way to send the token, resetting a password would lock the user
+// out for good, so the reset is refused before anything is changed.
+func TestResetPasswordAdminRequiresMailer(t *testing.T) {
+	app := newTestApplication(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/users/1/password-reset", nil)
+	w := httptest.NewRecorder()
+
+	app.resetPasswordAdminHandler(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusServiceUnavailable, w.Body.String())
+	}
+}
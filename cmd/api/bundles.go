@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+func (app *application) listBundlesHandler(w http.ResponseWriter, r *http.Request) {
+	bundles, err := app.models.Bundles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"bundles": bundles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showBundleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	bundle, err := app.models.Bundles.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"bundle": bundle}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createBundleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name            string  `json:"name"`
+		DiscountPercent int     `json:"discountPercent"`
+		Games           []int64 `json:"games"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	bundle := &model.Bundle{
+		Name:            input.Name,
+		DiscountPercent: input.DiscountPercent,
+		GameIds:         input.Games,
+	}
+
+	v := validator.New()
+
+	if model.ValidateBundle(v, bundle); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Bundles.Insert(bundle)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("games", "must only contain existing games")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	bundle, err = app.models.Bundles.Get(bundle.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"bundle": bundle}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteBundleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Bundles.Delete(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "bundle successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purchaseBundleHandler buys the games of a bundle the user doesn't own yet,
+// with the bundle discount applied to what is left.
+func (app *application) purchaseBundleHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	bundle, err := app.models.Bundles.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ids := append([]int64{}, bundle.GameIds...)
+	for _, game := range bundle.Games {
+		if game.BaseGameId != nil {
+			ids = append(ids, *game.BaseGameId)
+		}
+	}
+
+	owned, err := app.models.Library.OwnedOf(user.Id, ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	inBundle := make(map[int64]bool)
+	for _, id := range bundle.GameIds {
+		inBundle[id] = true
+	}
+
+	var buying []int64
+	var total float64
+
+	v := validator.New()
+
+	for _, game := range bundle.Games {
+		if owned[game.Id] {
+			continue
+		}
+		v.Check(game.Status == model.StatusReleased, "game", game.Title+" is not available for purchase")
+		if game.BaseGameId != nil {
+			base := *game.BaseGameId
+			v.Check(owned[base] || inBundle[base], "game", "you must own the base game of "+game.Title+" first")
+		}
+
+		buying = append(buying, game.Id)
+		total += game.Price
+	}
+
+	v.Check(len(buying) > 0, "library", "you already own every game in this bundle")
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	price := model.BundlePrice(total, bundle.DiscountPercent)
+
+	err = app.models.Library.Purchase(user.Id, buying, price)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrAlreadyOwned):
+			v.AddError("library", "some of these games were added to your library meanwhile, please try again")
+			app.failedValidatorResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrInsufficientFunds):
+			v.AddError("wallet", "insufficient funds")
+			app.failedValidatorResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"purchase": envelope{"bundleId": bundle.Id, "games": buying, "price": price}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+const maxImportBytes = 10 << 20
+
+// catalogColumns are the CSV columns of the catalog. Lists are separated by
+// "|", ageRating is written like "PEGI 16" and systemRequirements as JSON.
+// id and version are exported for reference and ignored on import.
+var catalogColumns = []string{"id", "sku", "title", "genres", "releaseDate", "price", "publisherId",
+	"shortDescription", "description", "developer", "platforms", "languages", "ageRating",
+	"systemRequirements", "screenshots", "trailers", "kind", "baseGameId", "status", "version"}
+
+type importError struct {
+	Line   int               `json:"line"`
+	SKU    string            `json:"sku,omitempty"`
+	Errors map[string]string `json:"errors"`
+}
+
+type importReport struct {
+	DryRun  bool          `json:"dryRun"`
+	Rows    int           `json:"rows"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Errors  []importError `json:"errors"`
+}
+
+type importRow struct {
+	line   int
+	game   *model.Game
+	errors map[string]string
+}
+
+// importGamesHandler creates or updates games by sku from a CSV or NDJSON
+// body. Nothing is imported unless every row is valid; with dry_run=true
+// nothing is imported either way and the report tells what would happen.
+func (app *application) importGamesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	format := app.readString(qs, "format", "")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = "csv"
+		case "application/x-ndjson", "application/jsonl":
+			format = "ndjson"
+		}
+	}
+
+	var dryRun bool
+	if b := app.readBool(qs, "dry_run", v); b != nil {
+		dryRun = *b
+	}
+
+	v.Check(validator.In(format, "csv", "ndjson"), "format", "must be csv or ndjson, or be given as the Content-Type")
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var rows []*importRow
+	var err error
+
+	switch format {
+	case "csv":
+		rows, err = readCatalogCSV(body)
+	default:
+		rows, err = readCatalogNDJSON(body)
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	genres, err := app.models.Genres.Slugs()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	publishers, err := app.models.Publishers.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	publisherIDs := make(map[int]bool)
+	for _, publisher := range publishers {
+		id, _ := strconv.Atoi(publisher.Id)
+		publisherIDs[id] = true
+	}
+
+	var skus []string
+	for _, row := range rows {
+		if row.errors == nil && row.game.SKU != "" {
+			skus = append(skus, row.game.SKU)
+		}
+	}
+
+	existing, err := app.models.Games.GetBySKUs(skus)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Rows are checked against the catalog as it will be after the import,
+	// so a DLC may refer to a game whose kind the same import changes.
+	var baseIDs []int64
+	for _, row := range rows {
+		if row.errors == nil && row.game.BaseGameId != nil {
+			baseIDs = append(baseIDs, *row.game.BaseGameId)
+		}
+	}
+
+	kinds, err := app.models.Games.GetKinds(baseIDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, row := range rows {
+		if target, ok := existing[row.game.SKU]; ok && row.errors == nil {
+			row.game.Id = target.Id
+			row.game.Includes = target.Includes
+			if _, ok := kinds[target.Id]; ok {
+				kinds[target.Id] = row.game.Kind
+			}
+		}
+	}
+
+	report := importReport{DryRun: dryRun, Rows: len(rows), Errors: []importError{}}
+
+	lines := make(map[string]int)
+	var games []*model.Game
+
+	for _, row := range rows {
+		if row.errors == nil {
+			rv := validator.New()
+
+			rv.Check(row.game.SKU != "", "sku", "must be provided")
+			if line, ok := lines[row.game.SKU]; ok && row.game.SKU != "" {
+				rv.AddError("sku", fmt.Sprintf("is a duplicate of line %d", line))
+			}
+
+			model.ValidateGame(rv, row.game, genres)
+			checkIncludes(rv, row.game)
+			if target, ok := existing[row.game.SKU]; ok {
+				checkStatusChange(rv, target.Status, row.game.Status)
+			} else {
+				checkStatusChange(rv, "", row.game.Status)
+			}
+			checkBaseGame(rv, row.game, kinds)
+
+			if row.game.PublisherId > 0 {
+				rv.Check(publisherIDs[row.game.PublisherId], "publisherId", "must be an existing publisher")
+			}
+
+			lines[row.game.SKU] = row.line
+			row.errors = rv.Errors
+		}
+
+		if len(row.errors) > 0 {
+			report.Errors = append(report.Errors, importError{Line: row.line, SKU: row.game.SKU, Errors: row.errors})
+			continue
+		}
+
+		games = append(games, row.game)
+	}
+
+	if len(report.Errors) > 0 {
+		err = app.writeJSON(w, http.StatusUnprocessableEntity, envelope{"import": report}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if dryRun {
+		for _, game := range games {
+			if game.Id != 0 {
+				report.Updated++
+			} else {
+				report.Created++
+			}
+		}
+	} else {
+		report.Created, report.Updated, err = app.models.Games.Import(games)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrRecordNotFound):
+				app.failedValidatorResponse(w, r, map[string]string{"baseGameId": "must be an existing game"})
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"import": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportGamesHandler streams the whole catalog as CSV or NDJSON. Once the
+// first game is written errors can't be reported to the client anymore,
+// they are only logged and the response is cut short.
+func (app *application) exportGamesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	format := app.readString(r.URL.Query(), "format", "ndjson")
+
+	if v.Check(validator.In(format, "csv", "ndjson"), "format", "must be csv or ndjson"); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	// Streaming a large catalog can outlast the server's write timeout.
+	err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var cw *csv.Writer
+	var write func(*model.Game) error
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		cw = csv.NewWriter(w)
+		write = func(game *model.Game) error {
+			return cw.Write(catalogRecord(game))
+		}
+	default:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		write = func(game *model.Game) error {
+			return enc.Encode(game)
+		}
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="games.%s"`, format))
+	w.WriteHeader(http.StatusOK)
+
+	if cw != nil {
+		err = cw.Write(catalogColumns)
+	}
+	if err == nil {
+		err = app.models.Games.Export(write)
+	}
+	if err == nil && cw != nil {
+		cw.Flush()
+		err = cw.Error()
+	}
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func catalogRecord(game *model.Game) []string {
+	var ageRating string
+	if game.AgeRating != nil {
+		ageRating = game.AgeRating.System + " " + game.AgeRating.Rating
+	}
+
+	requirements, _ := json.Marshal(game.SystemRequirements)
+
+	var baseGameId string
+	if game.BaseGameId != nil {
+		baseGameId = strconv.FormatInt(*game.BaseGameId, 10)
+	}
+
+	return []string{
+		strconv.FormatInt(game.Id, 10),
+		game.SKU,
+		game.Title,
+		strings.Join(game.Genres, "|"),
+		game.ReleaseDate.Format(time.RFC3339),
+		strconv.FormatFloat(game.Price, 'f', -1, 64),
+		strconv.Itoa(game.PublisherId),
+		game.ShortDescription,
+		game.Description,
+		game.Developer,
+		strings.Join(game.Platforms, "|"),
+		strings.Join(game.Languages, "|"),
+		ageRating,
+		string(requirements),
+		strings.Join(game.Screenshots, "|"),
+		strings.Join(game.Trailers, "|"),
+		game.Kind,
+		baseGameId,
+		game.Status,
+		strconv.Itoa(int(game.Version)),
+	}
+}
+
+// readCatalogCSV reads the games of a CSV catalog. The header decides which
+// columns are present. Values that can't be parsed are reported on the row
+// rather than failing the whole import.
+func readCatalogCSV(body io.Reader) ([]*importRow, error) {
+	cr := csv.NewReader(body)
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	for _, column := range header {
+		if !validator.In(column, catalogColumns...) {
+			return nil, fmt.Errorf("unknown CSV column %q", column)
+		}
+	}
+	if !validator.Unique(header) {
+		return nil, errors.New("CSV header must not contain duplicate columns")
+	}
+
+	var rows []*importRow
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV: %w", err)
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := &importRow{line: line, game: &model.Game{Kind: model.KindGame, Status: model.StatusReleased}}
+		rowErrors := make(map[string]string)
+
+		for i, column := range header {
+			if err := setCatalogField(row.game, column, record[i]); err != nil {
+				rowErrors[column] = err.Error()
+			}
+		}
+
+		if len(rowErrors) > 0 {
+			row.errors = rowErrors
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func setCatalogField(game *model.Game, column, value string) error {
+	list := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, "|")
+	}
+
+	switch column {
+	case "sku":
+		game.SKU = value
+	case "title":
+		game.Title = value
+	case "genres":
+		game.Genres = list(value)
+	case "releaseDate":
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", value)
+		}
+		if err != nil {
+			return errors.New("must be a date like 2006-01-02 or an RFC 3339 timestamp")
+		}
+		game.ReleaseDate = t
+	case "price":
+		price, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		game.Price = price
+	case "publisherId":
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("must be an integer value")
+		}
+		game.PublisherId = id
+	case "shortDescription":
+		game.ShortDescription = value
+	case "description":
+		game.Description = value
+	case "developer":
+		game.Developer = value
+	case "platforms":
+		game.Platforms = list(value)
+	case "languages":
+		game.Languages = list(value)
+	case "ageRating":
+		if value == "" {
+			return nil
+		}
+		var rating model.AgeRating
+		if err := rating.Scan(value); err != nil {
+			return errors.New(`must be a rating like "PEGI 16"`)
+		}
+		game.AgeRating = &rating
+	case "systemRequirements":
+		if value == "" {
+			return nil
+		}
+		if err := json.Unmarshal([]byte(value), &game.SystemRequirements); err != nil {
+			return errors.New("must be a JSON object")
+		}
+	case "screenshots":
+		game.Screenshots = list(value)
+	case "trailers":
+		game.Trailers = list(value)
+	case "kind":
+		if value != "" {
+			game.Kind = value
+		}
+	case "status":
+		if value != "" {
+			game.Status = value
+		}
+	case "baseGameId":
+		if value == "" {
+			return nil
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("must be an integer value")
+		}
+		game.BaseGameId = &id
+	}
+
+	return nil
+}
+
+// readCatalogNDJSON reads one game per line, in the same JSON as the games
+// API. Blank lines are skipped.
+func readCatalogNDJSON(body io.Reader) ([]*importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	var rows []*importRow
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		row := &importRow{line: line, game: &model.Game{Kind: model.KindGame, Status: model.StatusReleased}}
+
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(row.game); err != nil {
+			row.errors = map[string]string{"json": err.Error()}
+		}
+
+		// Ids and versions belong to this catalog, not to the import.
+		row.game.Id, row.game.Version, row.game.Publisher, row.game.Includes = 0, 0, nil, nil
+
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading NDJSON: %w", err)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/model"
+)
+
+func TestSetCatalogField(t *testing.T) {
+	baseGameID := int64(4)
+
+	// Rows start out as released games, like in readCatalogCSV; want
+	// changes that starting point into the expected game.
+	tests := []struct {
+		column  string
+		value   string
+		want    func(game *model.Game)
+		wantErr bool
+	}{
+		{column: "sku", value: "PORTAL-1", want: func(g *model.Game) { g.SKU = "PORTAL-1" }},
+		{column: "genres", value: "puzzle|platformer", want: func(g *model.Game) { g.Genres = []string{"puzzle", "platformer"} }},
+		{column: "genres", value: ""},
+		{column: "releaseDate", value: "2007-10-10", want: func(g *model.Game) { g.ReleaseDate = time.Date(2007, 10, 10, 0, 0, 0, 0, time.UTC) }},
+		{column: "releaseDate", value: "2007-10-10T12:00:00Z", want: func(g *model.Game) { g.ReleaseDate = time.Date(2007, 10, 10, 12, 0, 0, 0, time.UTC) }},
+		{column: "releaseDate", value: "10/10/2007", wantErr: true},
+		{column: "price", value: "9.99", want: func(g *model.Game) { g.Price = 9.99 }},
+		{column: "price", value: "free", wantErr: true},
+		{column: "publisherId", value: "3", want: func(g *model.Game) { g.PublisherId = 3 }},
+		{column: "publisherId", value: "3.5", wantErr: true},
+		{column: "ageRating", value: "PEGI 16", want: func(g *model.Game) { g.AgeRating = &model.AgeRating{System: "PEGI", Rating: "16"} }},
+		{column: "ageRating", value: ""},
+		{column: "ageRating", value: "PEGI16", wantErr: true},
+		{
+			column: "systemRequirements",
+			value:  `{"minimum":{"os":"Windows 10"}}`,
+			want: func(g *model.Game) {
+				g.SystemRequirements = model.SystemRequirements{Minimum: &model.Requirements{OS: "Windows 10"}}
+			},
+		},
+		{column: "systemRequirements", value: "8 GB RAM", wantErr: true},
+		{column: "kind", value: ""},
+		{column: "kind", value: "dlc", want: func(g *model.Game) { g.Kind = model.KindDLC }},
+		{column: "status", value: ""},
+		{column: "status", value: "announced", want: func(g *model.Game) { g.Status = model.StatusAnnounced }},
+		{column: "baseGameId", value: "4", want: func(g *model.Game) { g.BaseGameId = &baseGameID }},
+		{column: "baseGameId", value: ""},
+		{column: "baseGameId", value: "four", wantErr: true},
+		{column: "id", value: "99"},
+		{column: "version", value: "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.column+"="+tt.value, func(t *testing.T) {
+			game := model.Game{Kind: model.KindGame, Status: model.StatusReleased}
+
+			want := game
+			if tt.want != nil {
+				tt.want(&want)
+			}
+
+			err := setCatalogField(&game, tt.column, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(game, want) {
+				t.Fatalf("got %+v, want %+v", game, want)
+			}
+		})
+	}
+}
+
+func TestReadCatalogNDJSON(t *testing.T) {
+	body := strings.Join([]string{
+		`{"sku":"PORTAL-1","title":"Portal","id":99,"version":7,"includes":[1,2],"publisher":{"id":"1"}}`,
+		``,
+		`{"sku":"PORTAL-2","kind":"dlc","status":"announced"}`,
+		`{"sku":"BROKEN","unknown":true}`,
+		`not json`,
+	}, "\n")
+
+	rows, err := readCatalogNDJSON(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line       int
+		sku        string
+		kind       string
+		status     string
+		wantErrors bool
+	}{
+		{line: 1, sku: "PORTAL-1", kind: model.KindGame, status: model.StatusReleased},
+		{line: 3, sku: "PORTAL-2", kind: model.KindDLC, status: model.StatusAnnounced},
+		{line: 4, sku: "BROKEN", wantErrors: true},
+		{line: 5, wantErrors: true},
+	}
+
+	if len(rows) != len(tests) {
+		t.Fatalf("read %d rows, want %d", len(rows), len(tests))
+	}
+
+	for i, tt := range tests {
+		row := rows[i]
+
+		if row.line != tt.line {
+			t.Errorf("row %d: line = %d, want %d", i, row.line, tt.line)
+		}
+		if (row.errors != nil) != tt.wantErrors {
+			t.Errorf("line %d: errors = %v, want errors %v", tt.line, row.errors, tt.wantErrors)
+		}
+		if tt.wantErrors {
+			continue
+		}
+		if row.game.SKU != tt.sku || row.game.Kind != tt.kind || row.game.Status != tt.status {
+			t.Errorf("line %d: got %+v", tt.line, row.game)
+		}
+		if row.game.Id != 0 || row.game.Version != 0 || row.game.Includes != nil || row.game.Publisher != nil {
+			t.Errorf("line %d: catalog fields were imported: %+v", tt.line, row.game)
+		}
+	}
+}
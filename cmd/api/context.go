@@ -3,13 +3,20 @@ package main
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/ermapula/golang-project/pkg/model"
 )
 
 type contextKey string 
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	permissionsContextKey = contextKey("permissions")
+	tokenContextKey       = contextKey("token")
+	apiKeyContextKey      = contextKey("apiKey")
+	issuedAtContextKey    = contextKey("issuedAt")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *model.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -25,3 +32,46 @@ func (app *application) contextGetUser(r *http.Request) *model.User {
 	return user
 }
 
+func (app *application) contextSetPermissions(r *http.Request, permissions model.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetPermissions(r *http.Request) (model.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(model.Permissions)
+	return permissions, ok
+}
+
+func (app *application) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
+
+func (app *application) contextSetAPIKey(r *http.Request, key *model.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey returns the API key the request was authenticated with,
+// or nil.
+func (app *application) contextGetAPIKey(r *http.Request) *model.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*model.APIKey)
+	return key
+}
+
+// contextSetIssuedAt records when the JWT the request was authenticated with
+// was issued. Opaque tokens keep that in the database instead.
+func (app *application) contextSetIssuedAt(r *http.Request, issuedAt time.Time) *http.Request {
+	ctx := context.WithValue(r.Context(), issuedAtContextKey, issuedAt)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetIssuedAt(r *http.Request) (time.Time, bool) {
+	issuedAt, ok := r.Context().Value(issuedAtContextKey).(time.Time)
+	return issuedAt, ok
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/model"
+)
+
+func (app *application) createDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	export := &model.DataExport{UserID: user.Id}
+
+	err := app.models.Exports.Insert(export)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrExportPending):
+			app.errorResponse(w, r, http.StatusConflict, "an export is already being prepared, please wait for it to finish")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		archive, err := app.buildDataExport(user.Id)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"export_id": strconv.FormatInt(export.Id, 10)})
+			err = app.models.Exports.Fail(export.Id, "the export could not be assembled, please try again")
+		} else {
+			err = app.models.Exports.Complete(export.Id, archive, app.config.exports.ttl)
+		}
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"export_id": strconv.FormatInt(export.Id, 10)})
+		}
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/users/me/export/%d", export.Id))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"export": export}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	export, err := app.models.Exports.Get(int64(id), user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"export": export}
+	if export.Status == model.ExportReady {
+		data["download_url"] = fmt.Sprintf("/users/me/export/%d/download", export.Id)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) downloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	archive, err := app.models.Exports.GetArchive(int64(id), user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%d.zip"`, id))
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// buildDataExport collects everything stored about the user into a zip
+// archive with one JSON file per kind of record.
+func (app *application) buildDataExport(userID int64) ([]byte, error) {
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	library, err := app.models.Games.GetAllOfUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	playSessions, err := app.models.Library.GetSessionsForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := app.models.Users.GetWallet(userID)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := app.models.Tokens.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type session struct {
+		Scope  string    `json:"scope"`
+		Expiry time.Time `json:"expiry"`
+	}
+	sessions := []session{}
+	for _, token := range tokens {
+		sessions = append(sessions, session{Scope: token.Scope, Expiry: token.Expiry})
+	}
+
+	apiKeys, err := app.models.APIKeys.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	logins, err := app.models.Logins.GetRecentForUser(userID, 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := app.models.TwoFactor.Enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	preorders, err := app.models.Preorders.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	adjustments, err := app.models.Users.GetWalletAdjustments(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	achievements, err := app.models.Achievements.GetUnlockedForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	friends, err := app.models.Friends.GetFriends(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	incoming, outgoing, err := app.models.Friends.GetPendingRequests(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	blocked, err := app.models.Friends.GetBlocked(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	collections, err := app.models.Collections.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	family, err := app.models.Families.GetForUser(userID)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	familyInvites, err := app.models.Families.GetInvitesForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"user.json", envelope{"user": user, "two_factor_enabled": twoFactor}},
+		{"library.json", envelope{"games": library}},
+		{"play_sessions.json", envelope{"play_sessions": playSessions}},
+		{"wallet.json", envelope{"wallet": wallet, "adjustments": adjustments}},
+		{"preorders.json", envelope{"preorders": preorders}},
+		{"achievements.json", envelope{"achievements": achievements}},
+		{"friends.json", envelope{"friends": friends, "incoming_requests": incoming, "outgoing_requests": outgoing, "blocked": blocked}},
+		{"collections.json", envelope{"collections": collections}},
+		{"family.json", envelope{"family": family, "invites": familyInvites}},
+		{"permissions.json", envelope{"permissions": permissions}},
+		{"sessions.json", envelope{"sessions": sessions}},
+		{"api_keys.json", envelope{"api_keys": apiKeys}},
+		{"logins.json", envelope{"logins": logins}},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, file := range files {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
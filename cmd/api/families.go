@@ -0,0 +1,363 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+func (app *application) createFamilyHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	family := &model.Family{
+		OwnerID: user.Id,
+		Name:    input.Name,
+	}
+
+	v := validator.New()
+
+	if model.ValidateFamily(v, family); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Families.Insert(family)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrAlreadyInFamily):
+			v.AddError("family", "you are already in a family")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	family, err = app.models.Families.GetForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"family": family}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showFamilyHandler(w http.ResponseWriter, r *http.Request) {
+	family, ok := app.readFamily(w, r)
+	if !ok {
+		return
+	}
+
+	if family.OwnerID != app.contextGetUser(r).Id {
+		family.Invites = nil
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"family": family}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteFamilyHandler(w http.ResponseWriter, r *http.Request) {
+	family, ok := app.readOwnFamily(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Families.Delete(family.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "family successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createFamilyInviteHandler(w http.ResponseWriter, r *http.Request) {
+	family, ok := app.readOwnFamily(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.UserID > 0, "user_id", "must be a positive integer")
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Users.Get(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	invite, err := app.models.Families.Invite(family.Id, input.UserID, app.config.family.maxMembers)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrAlreadyInFamily):
+			v.AddError("user_id", "this user is already in a family")
+			app.failedValidatorResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrDuplicateInvite):
+			v.AddError("user_id", "this user has already been invited")
+			app.failedValidatorResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrFamilyFull):
+			v.AddError("family", "the family has reached its member limit")
+			app.failedValidatorResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"invite": invite}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listFamilyInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	invites, err := app.models.Families.GetInvitesForUser(app.contextGetUser(r).Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"invites": invites}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) acceptFamilyInviteHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Families.AcceptInvite(int64(id), user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrAlreadyInFamily):
+			app.failedValidatorResponse(w, r, map[string]string{"family": "you are already in a family"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	family, err := app.models.Families.GetForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	family.Invites = nil
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"family": family}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) declineFamilyInviteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Families.DeclineInvite(int64(id), app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "family invite declined"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeFamilyMemberHandler lets the owner remove a member, and members
+// leave. The owner can't leave, they have to delete the family instead.
+func (app *application) removeFamilyMemberHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	family, ok := app.readFamily(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	memberID := int64(id)
+
+	if memberID != user.Id && family.OwnerID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if memberID == family.OwnerID {
+		app.failedValidatorResponse(w, r, map[string]string{"member": "the owner cannot leave the family, delete it instead"})
+		return
+	}
+
+	err = app.models.Families.RemoveMember(family.Id, memberID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkoutGameHandler borrows a family member's copy of a game. Each copy
+// can be used by one member at a time; the lease runs out unless renewed by
+// checking out again. Owners check out their own copy to keep it from
+// being lent out while they play.
+func (app *application) checkoutGameHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	gameID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	lease, err := app.models.Families.Checkout(user.Id, int64(gameID), app.config.family.leaseTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrGameInUse):
+			app.gameInUseResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"lease": lease}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) returnGameHandler(w http.ResponseWriter, r *http.Request) {
+	gameID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Families.Return(app.contextGetUser(r).Id, int64(gameID))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "game successfully returned"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readFamily loads the current user's family and writes the error response
+// itself if that fails.
+func (app *application) readFamily(w http.ResponseWriter, r *http.Request) (*model.Family, bool) {
+	family, err := app.models.Families.GetForUser(app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return family, true
+}
+
+// readOwnFamily is readFamily for actions only the owner may take.
+func (app *application) readOwnFamily(w http.ResponseWriter, r *http.Request) (*model.Family, bool) {
+	family, ok := app.readFamily(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if family.OwnerID != app.contextGetUser(r).Id {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return family, true
+}
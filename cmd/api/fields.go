@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+var includeSafelist = []string{"publisher", "rating"}
+
+// fieldset is what a client asked to get back: only some fields, and
+// related objects to embed.
+type fieldset struct {
+	fields  []string
+	include []string
+}
+
+func (f fieldset) includes(relation string) bool {
+	return validator.In(relation, f.include...)
+}
+
+// readFieldset reads the fields and include parameters. allowed are the
+// fields of the resource; included relations can be picked as well.
+func (app *application) readFieldset(qs url.Values, allowed []string, v *validator.Validator) fieldset {
+	f := fieldset{
+		fields:  app.readCSV(qs, "fields", []string{}),
+		include: app.readCSV(qs, "include", []string{}),
+	}
+
+	for _, relation := range f.include {
+		v.Check(validator.In(relation, includeSafelist...), "include", "unknown relation "+relation)
+	}
+	v.Check(validator.Unique(f.include), "include", "must not contain duplicate values")
+
+	allowed = append(append([]string{}, allowed...), f.include...)
+	for _, field := range f.fields {
+		v.Check(validator.In(field, allowed...), "fields", "unknown field "+field)
+	}
+	v.Check(validator.Unique(f.fields), "fields", "must not contain duplicate values")
+
+	return f
+}
+
+// embed loads the relations asked for into the games.
+func (app *application) embed(f fieldset, games ...*model.Game) error {
+	if f.includes("rating") {
+		for _, game := range games {
+			if game.AgeRating != nil {
+				game.Rating = game.AgeRating.Embed()
+			}
+		}
+	}
+
+	if !f.includes("publisher") || len(games) == 0 {
+		return nil
+	}
+
+	var ids []int64
+	for _, game := range games {
+		ids = append(ids, int64(game.PublisherId))
+	}
+
+	publishers, err := app.models.Publishers.GetByIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, game := range games {
+		game.Publisher = publishers[strconv.Itoa(game.PublisherId)]
+	}
+
+	return nil
+}
+
+// pick trims a resource, or each one of a slice of resources, down to the
+// fields asked for. Everything is kept if no fields were asked for.
+func (f fieldset) pick(data interface{}) (interface{}, error) {
+	if len(f.fields) == 0 {
+		return data, nil
+	}
+
+	js, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(js) == "null" {
+		return data, nil
+	}
+
+	if js[0] == '[' {
+		var all []map[string]json.RawMessage
+		if err := json.Unmarshal(js, &all); err != nil {
+			return nil, err
+		}
+
+		picked := make([]map[string]json.RawMessage, len(all))
+		for i, item := range all {
+			picked[i] = f.pickFields(item)
+		}
+
+		return picked, nil
+	}
+
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(js, &item); err != nil {
+		return nil, err
+	}
+
+	return f.pickFields(item), nil
+}
+
+func (f fieldset) pickFields(item map[string]json.RawMessage) map[string]json.RawMessage {
+	picked := make(map[string]json.RawMessage, len(f.fields))
+
+	for _, field := range f.fields {
+		if value, ok := item[field]; ok {
+			picked[field] = value
+		}
+	}
+
+	return picked
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+func TestReadFieldset(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{query: ""},
+		{query: "fields=id,title"},
+		{query: "include=publisher,rating"},
+		{query: "fields=id,rating&include=rating"},
+		{query: "fields=id,rating", wantErr: "fields"},
+		{query: "fields=id,secret", wantErr: "fields"},
+		{query: "fields=id,id", wantErr: "fields"},
+		{query: "include=reviews", wantErr: "include"},
+		{query: "include=rating,rating", wantErr: "include"},
+	}
+
+	app := newTestApplication(t)
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			qs, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v := validator.New()
+			app.readFieldset(qs, model.GameFields, v)
+
+			if tt.wantErr == "" && !v.Valid() {
+				t.Fatalf("unexpected errors %v", v.Errors)
+			}
+			if _, ok := v.Errors[tt.wantErr]; tt.wantErr != "" && !ok {
+				t.Fatalf("want an error for %q, got %v", tt.wantErr, v.Errors)
+			}
+		})
+	}
+}
+
+func TestEmbedRating(t *testing.T) {
+	rated := &model.Game{Id: 1, AgeRating: &model.AgeRating{System: "ESRB", Rating: "T"}}
+	unrated := &model.Game{Id: 2}
+
+	app := newTestApplication(t)
+
+	err := app.embed(fieldset{include: []string{"rating"}}, rated, unrated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := model.Rating{System: "ESRB", Rating: "T", MinimumAge: 13}
+	if rated.Rating == nil || *rated.Rating != want {
+		t.Fatalf("rating = %+v, want %+v", rated.Rating, want)
+	}
+	if unrated.Rating != nil {
+		t.Fatalf("unrated game got rating %+v", unrated.Rating)
+	}
+}
+
+func TestPick(t *testing.T) {
+	game := &model.Game{Id: 7, Title: "Portal", Price: 9.99}
+
+	tests := []struct {
+		name   string
+		fields []string
+		data   interface{}
+		want   string
+	}{
+		{name: "everything", data: map[string]int{"id": 7}, want: `{"id":7}`},
+		{name: "object", fields: []string{"id", "title"}, data: game, want: `{"id":7,"title":"Portal"}`},
+		{name: "slice", fields: []string{"price"}, data: []*model.Game{game, game}, want: `[{"price":9.99},{"price":9.99}]`},
+		{name: "missing field", fields: []string{"publisher"}, data: game, want: `{}`},
+		{name: "nil", fields: []string{"id"}, data: (*model.Game)(nil), want: `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picked, err := fieldset{fields: tt.fields}.pick(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			js, err := json.Marshal(picked)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(js) != tt.want {
+				t.Fatalf("got %s, want %s", js, tt.want)
+			}
+		})
+	}
+}
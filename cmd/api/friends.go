@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+func (app *application) sendFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.UserID > 0, "user_id", "must be a positive integer")
+	v.Check(input.UserID != user.Id, "user_id", "you cannot send a friend request to yourself")
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Users.Get(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	request, err := app.models.Friends.SendRequest(user.Id, input.UserID)
+	if err != nil {
+		switch {
+		// Don't reveal that the other user blocked us.
+		case errors.Is(err, model.ErrBlocked):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrAlreadyFriends):
+			v.AddError("user_id", "you are already friends with this user")
+			app.failedValidatorResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrDuplicateRequest):
+			v.AddError("user_id", "a friend request to this user is already pending")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"friend_request": request}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listFriendRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	incoming, outgoing, err := app.models.Friends.GetPendingRequests(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"incoming": incoming, "outgoing": outgoing}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) acceptFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.respondToFriendRequest(w, r, true)
+}
+
+func (app *application) declineFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.respondToFriendRequest(w, r, false)
+}
+
+func (app *application) respondToFriendRequest(w http.ResponseWriter, r *http.Request, accept bool) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Friends.Respond(int64(id), user.Id, accept)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	message := "friend request declined"
+	if accept {
+		message = "friend request accepted"
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listFriendsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	friends, err := app.models.Friends.GetFriends(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"friends": friends}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeFriendHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Friends.Remove(user.Id, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "friend successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showFriendGamesHandler(w http.ResponseWriter, r *http.Request) {
+	viewer := app.contextGetUser(r)
+
+	owner, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	visible, err := app.canViewLibrary(viewer, owner)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		app.privateLibraryResponse(w, r)
+		return
+	}
+
+	games, err := app.models.Games.GetAllOfUser(owner.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"games": games}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// canViewLibrary applies the owner's library privacy setting to the viewer.
+// Blocking hides the library either way.
+func (app *application) canViewLibrary(viewer, owner *model.User) (bool, error) {
+	if viewer.Id == owner.Id {
+		return true, nil
+	}
+
+	if !viewer.IsAnonymous() {
+		blocked, err := app.models.Friends.IsBlocked(viewer.Id, owner.Id)
+		if err != nil || blocked {
+			return false, err
+		}
+	}
+
+	switch owner.LibraryPrivacy {
+	case model.PrivacyPublic:
+		return true, nil
+	case model.PrivacyFriends:
+		if viewer.IsAnonymous() {
+			return false, nil
+		}
+		return app.models.Friends.AreFriends(viewer.Id, owner.Id)
+	default:
+		return false, nil
+	}
+}
+
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.UserID > 0, "user_id", "must be a positive integer")
+	v.Check(input.UserID != user.Id, "user_id", "you cannot block yourself")
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Users.Get(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Friends.Block(user.Id, input.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"message": "user successfully blocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	blocked, err := app.models.Friends.GetBlocked(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"blocked": blocked}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Friends.Unblock(user.Id, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user successfully unblocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
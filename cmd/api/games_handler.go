@@ -3,6 +3,8 @@ package main
 import (
 	"errors"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/ermapula/golang-project/pkg/model"
@@ -16,6 +18,15 @@ func (app *application) getGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	v := validator.New()
+
+	fields := app.readFieldset(r.URL.Query(), model.GameFields, v)
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
 	game, err := app.models.Games.Get(id)
 	if err != nil {
 		switch {
@@ -27,46 +38,77 @@ func (app *application) getGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"game": game}, nil)
+	if game.Status == model.StatusDelisted {
+		visible, err := app.canSeeDelisted(r, game.Id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !visible {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+
+	err = app.embed(fields, game)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	picked, err := fields.pick(game)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"game": picked}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) getGames(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title       string
-		Genres      []string
-		PublisherId int
-		model.Filters
+// canSeeDelisted reports whether a delisted game is still visible to the
+// user: to its owners and to staff who can edit games.
+func (app *application) canSeeDelisted(r *http.Request, gameID int64) (bool, error) {
+	permissions, err := app.userPermissions(r)
+	if err != nil {
+		return false, err
 	}
 
+	if permissions.Include("games:write") {
+		return true, nil
+	}
+
+	return app.models.Library.Owns(app.contextGetUser(r).Id, gameID)
+}
+
+func (app *application) getGames(w http.ResponseWriter, r *http.Request) {
 	v := validator.New()
 
 	qs := r.URL.Query()
 
-	input.PublisherId = app.readInt(qs, "publisher_id", -1, v)
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
-	
-	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "price", "release_date", "-id", "-title", "-price", "-release_date"}
+	search, filters, fields := app.readGameListing(qs, app.readInt(qs, "publisher_id", -1, v), v)
 
-	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+	if model.ValidateFilters(v, filters); !v.Valid() {
 		app.failedValidatorResponse(w, r, v.Errors)
 		return
 	}
 
-	games, metadata, err := app.models.Games.GetAll(input.Title, input.Genres, input.PublisherId, input.Filters)
+	picked, metadata, err := app.listGames(search, filters, fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	facets, err := app.models.Games.Facets(search)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"games": games, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"games": picked, "metadata": metadata, "facets": facets}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -79,51 +121,164 @@ func (app *application) getPublisherGames(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var input struct {
-		Title       string
-		Genres      []string
-		PublisherId int
-		model.Filters
+	v := validator.New()
+
+	search, filters, fields := app.readGameListing(r.URL.Query(), id, v)
+
+	if model.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
 	}
 
+	picked, metadata, err := app.listGames(search, filters, fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"games": picked, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readGameListing reads the search, pagination and fieldset shared by the
+// game listings, which differ in where the publisher comes from.
+func (app *application) readGameListing(qs url.Values, publisherID int, v *validator.Validator) (model.GameSearch, model.Filters, fieldset) {
+	search := app.readGameSearch(qs, v)
+	search.PublisherId = publisherID
+
+	var filters model.Filters
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Search results are sorted by relevance unless asked otherwise.
+	defaultSort := "id"
+	if search.Query != "" {
+		defaultSort = "relevance"
+	}
+
+	filters.Sort = app.readString(qs, "sort", defaultSort)
+	filters.SortSafelist = []string{"id", "title", "price", "release_date", "relevance", "-id", "-title", "-price", "-release_date"}
+	app.readCursor(qs, &filters, model.FilterHash(search), v)
+
+	fields := app.readFieldset(qs, model.GameFields, v)
+
+	return search, filters, fields
+}
+
+// listGames fetches a page of a game listing, with the relations and fields
+// the client asked for.
+func (app *application) listGames(search model.GameSearch, filters model.Filters, fields fieldset) (interface{}, model.Metadata, error) {
+	games, metadata, err := app.models.Games.GetAll(search, filters)
+	if err != nil {
+		return nil, model.Metadata{}, err
+	}
+
+	err = app.embed(fields, games...)
+	if err != nil {
+		return nil, model.Metadata{}, err
+	}
+
+	picked, err := fields.pick(games)
+	if err != nil {
+		return nil, model.Metadata{}, err
+	}
+
+	return picked, metadata, nil
+}
+
+// suggestGamesHandler backs the search box type-ahead. It's open to
+// anonymous users, so it is rate limited per client instead.
+func (app *application) suggestGamesHandler(w http.ResponseWriter, r *http.Request) {
 	v := validator.New()
 
-	qs := r.URL.Query()
-	input.PublisherId = id
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
-	
-	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	q := strings.TrimSpace(app.readString(r.URL.Query(), "q", ""))
 
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "price", "release_date", "-id", "-title", "-price", "-release_date"}
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 100, "q", "must not be more than 100 bytes long")
 
-	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+	if !v.Valid() {
 		app.failedValidatorResponse(w, r, v.Errors)
 		return
 	}
 
-	games, metadata, err := app.models.Games.GetAll(input.Title, input.Genres, input.PublisherId, input.Filters)
+	suggestions, err := app.models.Games.Suggest(q, app.config.suggest.limit)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"games": games, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// readGameSearch reads the filters shared by the game listings. The
+// publisher is left to the caller.
+func (app *application) readGameSearch(qs url.Values, v *validator.Validator) model.GameSearch {
+	search := model.GameSearch{
+		Title:           app.readString(qs, "title", ""),
+		Query:           app.readString(qs, "q", ""),
+		Genres:          app.readCSV(qs, "genres", []string{}),
+		PublisherId:     -1,
+		Platform:        app.readString(qs, "platform", ""),
+		Language:        app.readString(qs, "language", ""),
+		MaxAgeRating:    app.readInt(qs, "max_age_rating", -1, v),
+		Tag:             model.Slugify(app.readString(qs, "tag", "")),
+		MinPrice:        app.readFloat(qs, "min_price", -1, v),
+		MaxPrice:        app.readFloat(qs, "max_price", -1, v),
+		ReleaseDateFrom: app.readDate(qs, "release_date_from", v),
+		ReleaseDateTo:   app.readDate(qs, "release_date_to", v),
+	}
+
+	if search.Platform != "" {
+		v.Check(validator.In(search.Platform, model.PlatformSafelist...), "platform", "invalid platform")
+	}
+	if qs.Has("max_age_rating") {
+		v.Check(search.MaxAgeRating >= 0 && search.MaxAgeRating <= 18, "max_age_rating", "must be between 0 and 18")
+	}
+	if qs.Has("min_price") {
+		v.Check(search.MinPrice >= 0, "min_price", "must be at least zero")
+	}
+	if qs.Has("max_price") {
+		v.Check(search.MaxPrice >= 0, "max_price", "must be at least zero")
+		v.Check(search.MinPrice <= search.MaxPrice, "max_price", "must not be less than min_price")
+	}
+	if search.ReleaseDateFrom != nil && search.ReleaseDateTo != nil {
+		v.Check(!search.ReleaseDateTo.Before(*search.ReleaseDateFrom), "release_date_to", "must not be before release_date_from")
+	}
+	v.Check(len(search.Query) <= 200, "q", "must not be more than 200 bytes long")
+
+	return search
+}
+
 func (app *application) postGame(w http.ResponseWriter, r *http.Request) {
 	var input struct {
+		SKU         string    `json:"sku"`
 		Title       string    `json:"title"`
 		Genres      []string  `json:"genres"`
 		ReleaseDate time.Time `json:"releaseDate"`
 		Price       float64   `json:"price"`
 		PublisherId int       `json:"publisherId"`
-	}
+		ShortDescription   string                   `json:"shortDescription"`
+		Description        string                   `json:"description"`
+		Developer          string                   `json:"developer"`
+		Platforms          []string                 `json:"platforms"`
+		Languages          []string                 `json:"languages"`
+		AgeRating          *model.AgeRating         `json:"ageRating"`
+		SystemRequirements model.SystemRequirements `json:"systemRequirements"`
+		Screenshots        []string                 `json:"screenshots"`
+		Trailers           []string                 `json:"trailers"`
+		Kind               string                   `json:"kind"`
+		BaseGameId         *int64                   `json:"baseGameId"`
+		Status             string                   `json:"status"`
+	}
+
+	input.Kind = model.KindGame
+	input.Status = model.StatusReleased
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -131,22 +286,57 @@ func (app *application) postGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	game := &model.Game{
+		SKU:         input.SKU,
 		Title:       input.Title,
 		Genres:      input.Genres,
 		Price:       input.Price,
 		ReleaseDate: input.ReleaseDate,
 		PublisherId: input.PublisherId,
+		ShortDescription:   input.ShortDescription,
+		Description:        input.Description,
+		Developer:          input.Developer,
+		Platforms:          input.Platforms,
+		Languages:          input.Languages,
+		AgeRating:          input.AgeRating,
+		SystemRequirements: input.SystemRequirements,
+		Screenshots:        input.Screenshots,
+		Trailers:           input.Trailers,
+		Kind:               input.Kind,
+		BaseGameId:         input.BaseGameId,
+		Status:             input.Status,
+	}
+
+	genres, err := app.models.Genres.Slugs()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
 
-	if model.ValidateGame(v, game); !v.Valid() {
+	model.ValidateGame(v, game, genres)
+	checkStatusChange(v, "", game.Status)
+
+	err = app.validateBaseGame(v, game)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
 		app.failedValidatorResponse(w, r, v.Errors)
+		return
 	}
 
 	err = app.models.Games.Post(game)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, model.ErrDuplicateSKU):
+			v.AddError("sku", "a game with this sku already exists")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -174,11 +364,12 @@ func (app *application) deleteGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "game successfully delisted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
 func (app *application) updateGame(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -198,11 +389,24 @@ func (app *application) updateGame(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input struct {
+		SKU         *string    `json:"sku"`
 		Title       *string    `json:"title"`
 		Genres      []string   `json:"genres"`
 		ReleaseDate *time.Time `json:"releaseDate"`
 		Price       *float64   `json:"price"`
 		PublisherId *int       `json:"publisherId"`
+		ShortDescription   *string                   `json:"shortDescription"`
+		Description        *string                   `json:"description"`
+		Developer          *string                   `json:"developer"`
+		Platforms          []string                  `json:"platforms"`
+		Languages          []string                  `json:"languages"`
+		AgeRating          *model.AgeRating          `json:"ageRating"`
+		SystemRequirements *model.SystemRequirements `json:"systemRequirements"`
+		Screenshots        []string                  `json:"screenshots"`
+		Trailers           []string                  `json:"trailers"`
+		Kind               *string                   `json:"kind"`
+		BaseGameId         *int64                    `json:"baseGameId"`
+		Status             *string                   `json:"status"`
 	}
 	err = app.readJSON(w, r, &input)
 	if err != nil {
@@ -210,6 +414,9 @@ func (app *application) updateGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if input.SKU != nil {
+		game.SKU = *input.SKU
+	}
 	if input.Title != nil {
 		game.Title = *input.Title
 	}
@@ -225,9 +432,66 @@ func (app *application) updateGame(w http.ResponseWriter, r *http.Request) {
 	if input.PublisherId != nil {
 		game.PublisherId = *input.PublisherId
 	}
+	if input.ShortDescription != nil {
+		game.ShortDescription = *input.ShortDescription
+	}
+	if input.Description != nil {
+		game.Description = *input.Description
+	}
+	if input.Developer != nil {
+		game.Developer = *input.Developer
+	}
+	if input.Platforms != nil {
+		game.Platforms = input.Platforms
+	}
+	if input.Languages != nil {
+		game.Languages = input.Languages
+	}
+	if input.AgeRating != nil {
+		game.AgeRating = input.AgeRating
+	}
+	if input.SystemRequirements != nil {
+		game.SystemRequirements = *input.SystemRequirements
+	}
+	if input.Screenshots != nil {
+		game.Screenshots = input.Screenshots
+	}
+	if input.Trailers != nil {
+		game.Trailers = input.Trailers
+	}
+	if input.Kind != nil {
+		game.Kind = *input.Kind
+		if game.Kind != model.KindDLC {
+			game.BaseGameId = nil
+		}
+	}
+	if input.BaseGameId != nil {
+		game.BaseGameId = input.BaseGameId
+	}
+	status := game.Status
+	if input.Status != nil {
+		game.Status = *input.Status
+	}
+
+	genres, err := app.models.Genres.Slugs()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	v := validator.New()
-	if model.ValidateGame(v, game); !v.Valid() {
+
+	model.ValidateGame(v, game, genres)
+	checkIncludes(v, game)
+	checkStatusChange(v, status, game.Status)
+
+	err = app.validateBaseGame(v, game)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
 		app.failedValidatorResponse(w, r, v.Errors)
 		return
 	}
@@ -237,6 +501,9 @@ func (app *application) updateGame(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, model.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrDuplicateSKU):
+			v.AddError("sku", "a game with this sku already exists")
+			app.failedValidatorResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -248,3 +515,154 @@ func (app *application) updateGame(w http.ResponseWriter, r *http.Request) {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// validateBaseGame checks that the base game of a DLC exists and is a game
+// itself rather than another DLC or an edition.
+func (app *application) validateBaseGame(v *validator.Validator, game *model.Game) error {
+	if game.BaseGameId == nil {
+		return nil
+	}
+
+	kinds, err := app.models.Games.GetKinds([]int64{*game.BaseGameId})
+	if err != nil {
+		return err
+	}
+
+	checkBaseGame(v, game, kinds)
+
+	return nil
+}
+
+// checkBaseGame checks the base game of a DLC against the kinds of the
+// games it may refer to.
+func checkBaseGame(v *validator.Validator, game *model.Game, kinds map[int64]string) {
+	if game.BaseGameId == nil {
+		return
+	}
+
+	kind, ok := kinds[*game.BaseGameId]
+	v.Check(ok, "baseGameId", "must be an existing game")
+	if ok {
+		v.Check(kind == model.KindGame, "baseGameId", "must be a game, not "+kind)
+	}
+}
+
+// checkStatusChange keeps games from being delisted or listed again by
+// setting their status, which would skip the refunds of delisting and the
+// checks of restoring. from is empty for new games.
+func checkStatusChange(v *validator.Validator, from, to string) {
+	if from == model.StatusDelisted {
+		v.Check(to == model.StatusDelisted, "status", "must stay delisted, restore the game with POST /admin/games/:id/restore")
+	} else {
+		v.Check(to != model.StatusDelisted, "status", "must not be delisted, delist the game with DELETE /games/:id")
+	}
+}
+
+// checkIncludes keeps an edition from changing its kind while it includes
+// other games.
+func checkIncludes(v *validator.Validator, game *model.Game) {
+	if game.Kind != model.KindEdition {
+		v.Check(len(game.Includes) == 0, "kind", "must stay edition while other games are included")
+	}
+}
+
+// addGameIncludeHandler adds a game or DLC to an edition, so buying the
+// edition also adds it to the library.
+func (app *application) addGameIncludeHandler(w http.ResponseWriter, r *http.Request) {
+	game, includedID, ok := app.readGameInclude(w, r)
+	if !ok {
+		return
+	}
+
+	kinds, err := app.models.Games.GetKinds([]int64{includedID})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	kind, exists := kinds[includedID]
+	v.Check(exists, "includedId", "must be an existing game")
+	v.Check(kind != model.KindEdition, "includedId", "must not be another edition")
+	v.Check(includedID != game.Id, "includedId", "must not be the edition itself")
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Games.AddInclude(game.Id, includedID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrDuplicateInclude):
+			v.AddError("includedId", "is already included")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "game successfully included"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeGameIncludeHandler(w http.ResponseWriter, r *http.Request) {
+	game, includedID, ok := app.readGameInclude(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Games.RemoveInclude(game.Id, includedID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "game successfully removed from edition"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readGameInclude reads the edition and the included game id of an includes
+// route, writing the error response itself when it fails.
+func (app *application) readGameInclude(w http.ResponseWriter, r *http.Request) (*model.Game, int64, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, 0, false
+	}
+
+	includedID, err := app.readIntParam(r, "included_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, 0, false
+	}
+
+	game, err := app.models.Games.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, 0, false
+	}
+
+	if game.Kind != model.KindEdition {
+		app.failedValidatorResponse(w, r, map[string]string{"game": "only editions can include other games"})
+		return nil, 0, false
+	}
+
+	return game, int64(includedID), true
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+func TestCheckStatusChange(t *testing.T) {
+	tests := []struct {
+		from, to string
+		valid    bool
+	}{
+		{"", model.StatusReleased, true},
+		{"", model.StatusPreOrder, true},
+		{"", model.StatusDelisted, false},
+		{model.StatusAnnounced, model.StatusPreOrder, true},
+		{model.StatusReleased, model.StatusReleased, true},
+		{model.StatusReleased, model.StatusDelisted, false},
+		{model.StatusPreOrder, model.StatusDelisted, false},
+		{model.StatusDelisted, model.StatusDelisted, true},
+		{model.StatusDelisted, model.StatusReleased, false},
+		{model.StatusDelisted, model.StatusAnnounced, false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		checkStatusChange(v, tt.from, tt.to)
+
+		if v.Valid() != tt.valid {
+			t.Errorf("%q -> %q: valid = %v, want %v (%v)", tt.from, tt.to, v.Valid(), tt.valid, v.Errors)
+		}
+	}
+}
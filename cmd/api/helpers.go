@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,7 +10,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ermapula/golang-project/pkg/model"
 	"github.com/ermapula/golang-project/pkg/validator"
 	"github.com/gorilla/mux"
 )
@@ -36,11 +39,15 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 }
 
 func (app *application) readIDParam(r *http.Request) (int, error) {
+	return app.readIntParam(r, "id")
+}
+
+func (app *application) readIntParam(r *http.Request, name string) (int, error) {
 	vars := mux.Vars(r)
 	
-	id, err := strconv.Atoi(vars["id"])
+	id, err := strconv.Atoi(vars[name])
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -132,4 +139,113 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 
 	return i
-}
\ No newline at end of file
+}
+
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+
+	return f
+}
+
+// readDate reads a date in the form 2006-01-02.
+func (app *application) readDate(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		v.AddError(key, "must be a date like 2006-01-02")
+		return nil
+	}
+
+	return &t
+}
+
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
+// readCursor reads the cursor parameter into filters. Cursors only work with
+// the sort and the filters, given as their model.FilterHash, they were
+// issued for.
+func (app *application) readCursor(qs url.Values, filters *model.Filters, filter string, v *validator.Validator) {
+	filters.CursorKey = app.cursorKey
+	filters.Filter = filter
+
+	s := qs.Get("cursor")
+	if s == "" {
+		return
+	}
+
+	cursor, err := model.DecodeCursor(s, app.cursorKey)
+	if err != nil {
+		v.AddError("cursor", "invalid cursor")
+		return
+	}
+
+	v.Check(cursor.Sort == filters.Sort, "cursor", "was issued for a different sort")
+	v.Check(cursor.Filter == filter, "cursor", "was issued for different filters")
+	v.Check(!qs.Has("page"), "cursor", "cannot be combined with page")
+
+	filters.Cursor = cursor
+}
+
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// every runs job at the given interval until ctx is cancelled.
+func (app *application) every(ctx context.Context, name string, interval time.Duration, job func() error) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := job(); err != nil {
+					app.logger.PrintError(err, map[string]string{"job": name})
+				}
+			}
+		}
+	})
+}
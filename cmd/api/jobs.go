@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// startJobs launches the periodic maintenance jobs. They stop when ctx is
+// cancelled during shutdown.
+func (app *application) startJobs(ctx context.Context) {
+	app.every(ctx, "purge expired data exports", 10*time.Minute, app.models.Exports.DeleteExpired)
+	app.every(ctx, "lift expired suspensions", time.Minute, app.models.Users.LiftExpiredSuspensions)
+	app.every(ctx, "purge expired game leases", time.Hour, app.models.Families.DeleteExpiredLeases)
+	app.every(ctx, "fulfill released pre-orders", time.Minute, app.models.Preorders.FulfillReleased)
+	app.every(ctx, "prune idle rate limit clients", time.Minute, app.suggestLimiter.prune)
+	app.every(ctx, "refresh suggestion popularity", 5*time.Minute, app.models.Games.RefreshPopularity)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/ermapula/golang-project/pkg/model"
 	"github.com/ermapula/golang-project/pkg/validator"
@@ -11,7 +12,104 @@ import (
 func (app *application) showLibraryHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
-	games, err := app.models.Games.GetAllOfUser(user.Id)
+	var input struct {
+		model.LibrarySearch
+		model.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Title = app.readString(qs, "title", "")
+	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.CollectionID = int64(app.readInt(qs, "collection", 0, v))
+	input.Favorite = app.readBool(qs, "favorite", v)
+	input.Shared = app.readBool(qs, "shared", v)
+	if hidden := app.readBool(qs, "hidden", v); hidden != nil {
+		input.Hidden = *hidden
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "purchased_at")
+	input.Filters.SortSafelist = []string{
+		"title", "purchased_at", "playtime", "last_played",
+		"-title", "-purchased_at", "-playtime", "-last_played",
+	}
+
+	fields := app.readFieldset(qs, model.LibraryGameFields, v)
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.CollectionID != 0 {
+		_, err := app.models.Collections.Get(input.CollectionID, user.Id)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrRecordNotFound):
+				v.AddError("collection", "collection not found")
+				app.failedValidatorResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	games, metadata, err := app.models.Library.GetAll(user.Id, input.LibrarySearch, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	embedded := make([]*model.Game, len(games))
+	for i, game := range games {
+		embedded[i] = &game.Game
+	}
+
+	err = app.embed(fields, embedded...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	picked, err := fields.pick(games)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"games": picked, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateLibraryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	gameId, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Favorite *bool `json:"favorite"`
+		Hidden   *bool `json:"hidden"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Library.SetFlags(user.Id, int64(gameId), input.Favorite, input.Hidden)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
@@ -22,7 +120,10 @@ func (app *application) showLibraryHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	app.writeJSON(w, http.StatusOK, envelope{"games": games}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "library entry successfully updated"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) addLibraryHandler(w http.ResponseWriter, r *http.Request) {
@@ -45,64 +146,136 @@ func (app *application) addLibraryHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	wallet, err := app.models.Users.GetWallet(user.Id)
+	ids := []int64{game.Id}
+	if game.BaseGameId != nil {
+		ids = append(ids, *game.BaseGameId)
+	}
+
+	owned, err := app.models.Library.OwnedOf(user.Id, ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(!owned[game.Id], "library", "game already in library")
+	v.Check(validator.In(game.Status, model.StatusReleased, model.StatusPreOrder), "game", "is not available for purchase")
+	if game.BaseGameId != nil {
+		v.Check(owned[*game.BaseGameId], "game", "you must own the base game first")
+	}
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	if game.Status == model.StatusPreOrder {
+		app.preorderGame(w, r, user.Id, game)
+		return
+	}
+
+	err = app.models.Library.Purchase(user.Id, []int64{game.Id}, game.Price)
 	if err != nil {
 		switch {
+		case errors.Is(err, model.ErrAlreadyOwned):
+			v.AddError("library", "game already in library")
+			app.failedValidatorResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrInsufficientFunds):
+			v.AddError("wallet", "insufficient funds")
+			app.failedValidatorResponse(w, r, v.Errors)
 		case errors.Is(err, model.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
+		return
 	}
 
-	v := validator.New()
-	v.Check(wallet.Balance >= game.Price, "wallet", "insufficient funds")
-	if !v.Valid() {
-		app.failedValidatorResponse(w, r, v.Errors)
+	app.writeJSON(w, http.StatusCreated, envelope{"game": game}, nil)
+}
+
+func (app *application) removeLibraryHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	err = app.models.Games.AddToLibrary(user.Id, gameId)
+	err = app.models.Games.DeleteFromLibrary(user.Id, id)
 	if err != nil {
 		switch {
-		case err.Error() == "game already in library":
-			app.failedValidatorResponse(w, r, map[string]string{"library": "game already in library"})
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	_, err = app.models.Users.UpdateWallet(user.Id, -game.Price)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
 	}
-
-	app.writeJSON(w, http.StatusCreated, envelope{"game": game}, nil)
 }
 
-func (app *application) removeLibraryHandler(w http.ResponseWriter, r *http.Request) {
+// addPlaySessionHandler lets game clients report a finished play session.
+// The duration defaults to the time between start and end, but clients can
+// report less to leave out time spent idle.
+func (app *application) addPlaySessionHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
-	id, err := app.readIDParam(r)
+	gameId, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
 
-	err = app.models.Games.DeleteFromLibrary(user.Id, id)
+	var input struct {
+		StartedAt time.Time `json:"startedAt"`
+		EndedAt   time.Time `json:"endedAt"`
+		Duration  *int64    `json:"duration"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session := &model.PlaySession{
+		UserID:          user.Id,
+		GameID:          int64(gameId),
+		StartedAt:       input.StartedAt,
+		EndedAt:         input.EndedAt,
+		DurationSeconds: int64(input.EndedAt.Sub(input.StartedAt) / time.Second),
+	}
+	if input.Duration != nil {
+		session.DurationSeconds = *input.Duration
+	}
+
+	v := validator.New()
+
+	if model.ValidatePlaySession(v, session); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Library.AddSession(session)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrOverlappingSession):
+			v.AddError("startedAt", "overlaps a session already recorded for this game")
+			app.failedValidatorResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "success"}, nil)
+	err = app.writeJSON(w, http.StatusCreated, envelope{"session": session}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/model"
+)
+
+// loginLockout returns how long the client has to wait before it may try to
+// log in again as email, or zero if it is not locked out.
+func (app *application) loginLockout(email, ip string) (time.Duration, error) {
+	since := time.Now().Add(-app.config.login.window)
+
+	byEmail, err := app.models.Logins.FailuresForEmail(email, since)
+	if err != nil {
+		return 0, err
+	}
+
+	byIP, err := app.models.Logins.FailuresForIP(ip, since)
+	if err != nil {
+		return 0, err
+	}
+
+	wait := app.lockoutRemaining(byEmail, app.config.login.maxAttemptsPerEmail)
+	if ipWait := app.lockoutRemaining(byIP, app.config.login.maxAttemptsPerIP); ipWait > wait {
+		wait = ipWait
+	}
+
+	return wait, nil
+}
+
+// lockoutRemaining starts a lockout once threshold failures are reached and
+// doubles it with every failure after that, up to the configured maximum.
+func (app *application) lockoutRemaining(failures model.LoginFailures, threshold int) time.Duration {
+	if threshold <= 0 || failures.Count < threshold {
+		return 0
+	}
+
+	lockout := app.config.login.maxLockout
+	if shift := failures.Count - threshold; shift < 32 {
+		if d := app.config.login.lockout << shift; d > 0 && d < lockout {
+			lockout = d
+		}
+	}
+
+	remaining := time.Until(failures.LastFailure.Add(lockout))
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+func (app *application) recordLogin(r *http.Request, email string, user *model.User, success bool) {
+	event := &model.LoginEvent{
+		Email:     email,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   success,
+	}
+	if user != nil {
+		event.UserID = &user.Id
+	}
+
+	err := app.models.Logins.Insert(event)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func (app *application) listLoginEventsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	events, err := app.models.Logins.GetRecentForUser(user.Id, 20)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"logins": events}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"flag"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/ermapula/golang-project/pkg/jsonlog"
+	"github.com/ermapula/golang-project/pkg/jwt"
+	"github.com/ermapula/golang-project/pkg/mailer"
 	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/oidc"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -25,12 +30,57 @@ type config struct {
 	db   struct {
 		dsn string
 	}
+	jwt struct {
+		enabled   bool
+		keys      string
+		activeKey string
+		ttl       time.Duration
+	}
+	login struct {
+		maxAttemptsPerEmail int
+		maxAttemptsPerIP    int
+		window              time.Duration
+		lockout             time.Duration
+		maxLockout          time.Duration
+	}
+	oidc struct {
+		providers    string
+		redirectBase string
+	}
+	exports struct {
+		ttl time.Duration
+	}
+	family struct {
+		maxMembers int
+		leaseTTL   time.Duration
+	}
+	cursor struct {
+		secret string
+	}
+	suggest struct {
+		limit int
+		rps   float64
+		burst int
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
 }
 
 type application struct {
 	config config
 	models model.Models
 	logger *jsonlog.Logger
+	jwtKeys *jwt.KeySet
+	oidcProviders map[string]*oidc.Provider
+	suggestLimiter *rateLimiter
+	cursorKey []byte
+	mailer *mailer.Mailer
+	wg sync.WaitGroup
 }
 
 func main() {
@@ -40,6 +90,29 @@ func main() {
 	flag.IntVar(&cfg.port, "port", 8080, "Server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
 	flag.StringVar(&cfg.db.dsn, "DB-DSN", os.Getenv("DSN"), "Postgres DSN")
+	flag.BoolVar(&cfg.jwt.enabled, "jwt", os.Getenv("JWT_ENABLED") == "true", "Issue signed JWT authentication tokens instead of opaque ones; the user is still loaded on every request")
+	flag.StringVar(&cfg.jwt.keys, "jwt-keys", os.Getenv("JWT_KEYS"), "JWT signing keys as comma-separated 'kid:alg:base64key' entries (alg is HS256 or EdDSA)")
+	flag.StringVar(&cfg.jwt.activeKey, "jwt-active-key", os.Getenv("JWT_ACTIVE_KEY"), "Key id used to sign new JWTs")
+	flag.DurationVar(&cfg.jwt.ttl, "jwt-ttl", 24*time.Hour, "Lifetime of issued JWTs")
+	flag.IntVar(&cfg.login.maxAttemptsPerEmail, "login-max-attempts-email", 5, "Failed logins per email before lockout (0 disables)")
+	flag.IntVar(&cfg.login.maxAttemptsPerIP, "login-max-attempts-ip", 20, "Failed logins per IP address before lockout (0 disables)")
+	flag.DurationVar(&cfg.login.window, "login-window", 15*time.Minute, "Window in which failed logins are counted")
+	flag.DurationVar(&cfg.login.lockout, "login-lockout", 30*time.Second, "Initial lockout, doubled with every further failed login")
+	flag.DurationVar(&cfg.login.maxLockout, "login-max-lockout", 15*time.Minute, "Maximum lockout duration")
+	flag.StringVar(&cfg.oidc.providers, "oidc-providers", os.Getenv("OIDC_PROVIDERS"), `OpenID Connect providers as a JSON array of {"name", "issuer", "client_id", "client_secret"}`)
+	flag.StringVar(&cfg.oidc.redirectBase, "oidc-redirect-base", os.Getenv("OIDC_REDIRECT_BASE"), "Public base URL of this API, used to build OpenID Connect redirect URLs")
+	flag.DurationVar(&cfg.exports.ttl, "export-ttl", 24*time.Hour, "How long personal data export archives can be downloaded")
+	flag.IntVar(&cfg.family.maxMembers, "family-max-members", 6, "Maximum number of members in a family group, including the owner")
+	flag.DurationVar(&cfg.family.leaseTTL, "family-lease-ttl", 2*time.Hour, "How long a checkout of a shared game lasts before it has to be renewed")
+	flag.IntVar(&cfg.suggest.limit, "suggest-limit", 5, "Maximum number of games, publishers and genres each returned by search suggestions")
+	flag.Float64Var(&cfg.suggest.rps, "suggest-rps", 5, "Search suggestion requests allowed per second and client IP address")
+	flag.IntVar(&cfg.suggest.burst, "suggest-burst", 20, "Search suggestion requests a client IP address may burst")
+	flag.StringVar(&cfg.cursor.secret, "cursor-secret", os.Getenv("CURSOR_SECRET"), "Secret signing pagination cursors. If not provided, a random one is used and cursors expire on restart")
+	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SMTP_HOST"), "SMTP server for outgoing email. If not provided, no email is sent")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 587, "SMTP server port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Game Store <no-reply@example.com>", "Sender of outgoing email")
 	flag.Parse()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
@@ -51,6 +124,10 @@ func main() {
 		"migrations": cfg.migrations,
 	})
 
+	if err := validateRateLimit(cfg.suggest.rps, cfg.suggest.burst); err != nil {
+		logger.PrintFatal(fmt.Errorf("suggest: %w", err), nil)
+	}
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -62,9 +139,33 @@ func main() {
 		config: cfg,
 		models: model.NewModels(db),
 		logger: logger,
+		suggestLimiter: newRateLimiter(cfg.suggest.rps, cfg.suggest.burst),
+		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 	}
 
-	
+	if cfg.jwt.enabled {
+		app.jwtKeys, err = jwt.ParseKeySet(cfg.jwt.activeKey, cfg.jwt.keys)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		logger.PrintInfo("jwt authentication enabled", map[string]string{
+			"active_key": cfg.jwt.activeKey,
+		})
+	}
+
+	app.cursorKey = []byte(cfg.cursor.secret)
+	if len(app.cursorKey) == 0 {
+		app.cursorKey = make([]byte, 32)
+		_, err = rand.Read(app.cursorKey)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	app.oidcProviders, err = oidc.ParseProviders(cfg.oidc.providers, cfg.oidc.redirectBase)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
 	err = app.serve()
 	if err != nil {
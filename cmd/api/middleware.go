@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/ermapula/golang-project/pkg/jwt"
 	"github.com/ermapula/golang-project/pkg/model"
 	"github.com/ermapula/golang-project/pkg/validator"
 )
@@ -26,6 +28,12 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", "X-API-Key")
+
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+			app.authenticateAPIKey(w, r, next, apiKey)
+			return
+		}
 
 		authorizationHeader := r.Header.Get("Authorization")
 		if authorizationHeader == "" {
@@ -42,6 +50,43 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		token := headerParts[1]
 
+		if app.jwtKeys != nil && jwt.IsJWT(token) {
+			claims, err := app.jwtKeys.Verify(token)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			// The signature only proves the token was issued. Deleted users,
+			// revoked tokens, suspensions and permission changes are only
+			// known to the database, so the user is loaded like for opaque
+			// tokens and only the token lookup is saved.
+			user, err := app.models.Users.Get(claims.Subject)
+			if err != nil {
+				switch {
+				case errors.Is(err, model.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			if user.TokenGeneration != claims.Generation {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			if user.IsSuspended() {
+				app.suspendedAccountResponse(w, r, user)
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetIssuedAt(r, time.Unix(claims.IssuedAt, 0))
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		v := validator.New()
 
 		if model.ValidateTokenPlaintext(v, token); !v.Valid() {
@@ -59,13 +104,80 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			}
 			return
 		}
+		if user.IsSuspended() {
+			app.suspendedAccountResponse(w, r, user)
+			return
+		}
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, plaintext string) {
+	v := validator.New()
+
+	if model.ValidateAPIKeyPlaintext(v, plaintext); !v.Valid() {
+		app.invalidAPIKeyResponse(w, r)
+		return
+	}
+
+	user, key, err := app.models.APIKeys.GetForPlaintext(plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.invalidAPIKeyResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.IsSuspended() {
+		app.suspendedAccountResponse(w, r, user)
+		return
+	}
+
+	// A key never grants more than its owner currently holds.
+	granted, err := app.models.Permissions.GetAllForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetPermissions(r, key.Permissions.Intersect(granted))
+	r = app.contextSetAPIKey(r, key)
+
+	next.ServeHTTP(w, r)
+}
+
+// requireAuthenticatedUser and requireActivatedUser guard the endpoints of
+// a user's own account, wallet and library. API keys are refused there;
+// they only work on endpoints gated by a permission, so a leaked key can't
+// mint keys, spend money or take over the account.
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return app.authenticatedUser(app.rejectAPIKey(next))
+}
+
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return app.activatedUser(app.rejectAPIKey(next))
+}
+
+func (app *application) rejectAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetAPIKey(r) != nil {
+			app.apiKeyNotAllowedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) authenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
@@ -78,12 +190,12 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
-func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+func (app *application) activatedUser(next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
-		if user.IsAnonymous() {
-			app.authenticationRequiredResponse(w, r)
+		if user.IsSuspended() {
+			app.suspendedAccountResponse(w, r, user)
 			return
 		}
 
@@ -94,14 +206,23 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 
 		next.ServeHTTP(w, r)
 	})
-	return app.requireAuthenticatedUser(fn)
+	return app.authenticatedUser(fn)
+}
+
+// userPermissions returns the permissions of the request, which are narrower
+// than the user's own when they authenticated with an API key.
+func (app *application) userPermissions(r *http.Request) (model.Permissions, error) {
+	permissions, ok := app.contextGetPermissions(r)
+	if ok {
+		return permissions, nil
+	}
+
+	return app.models.Permissions.GetAllForUser(app.contextGetUser(r).Id)
 }
 
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		user := app.contextGetUser(r)
-		
-		permissions, err := app.models.Permissions.GetAllForUser(user.Id)
+		permissions, err := app.userPermissions(r)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -114,5 +235,5 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 
 		next.ServeHTTP(w, r)
 	}
-	return app.requireActivatedUser(fn)
+	return app.activatedUser(fn)
 }
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/oidc"
+	"github.com/ermapula/golang-project/pkg/validator"
+	"github.com/gorilla/mux"
+)
+
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[mux.Vars(r)["provider"]]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	state := &model.OIDCState{
+		Provider: provider.Name,
+		Expiry:   time.Now().Add(10 * time.Minute),
+	}
+
+	for _, dst := range []*string{&state.State, &state.Verifier, &state.Nonce} {
+		value, err := oidc.RandomString()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		*dst = value
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Identities.InsertState(state)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The state is also bound to this browser, so a callback URL started by
+	// someone else can't log the user into the other person's account.
+	http.SetCookie(w, oidcStateCookie(provider, state.State, state.Expiry))
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+const oidcStateCookieName = "oidc_state"
+
+func oidcStateCookie(provider *oidc.Provider, value string, expiry time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    value,
+		Path:     "/oauth/" + provider.Name + "/callback",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(provider.RedirectURL, "https://"),
+		// Lax still sends the cookie on the top-level redirect back from
+		// the provider.
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if expiry.IsZero() {
+		cookie.MaxAge = -1
+	} else {
+		cookie.Expires = expiry
+	}
+
+	return cookie
+}
+
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[mux.Vars(r)["provider"]]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	if providerError := qs.Get("error"); providerError != "" {
+		app.badRequestResponse(w, r, errors.New("identity provider returned an error: "+providerError))
+		return
+	}
+
+	v := validator.New()
+
+	code := app.readString(qs, "code", "")
+	stateParam := app.readString(qs, "state", "")
+	v.Check(code != "", "code", "must be provided")
+	v.Check(stateParam != "", "state", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateParam)) != 1 {
+		v.AddError("state", "login was not started from this browser")
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	http.SetCookie(w, oidcStateCookie(provider, "", time.Time{}))
+
+	state, err := app.models.Identities.ConsumeState(provider.Name, stateParam)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("state", "invalid or expired login state")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), code, state.Verifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, oidc.ErrUnknownKey):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.userForIdentity(provider.Name, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnverifiedEmail):
+			v.AddError("email", "the identity provider did not return a verified email address")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.IsSuspended() {
+		app.suspendedAccountResponse(w, r, user)
+		return
+	}
+
+	enrolled, err := app.models.TwoFactor.Enabled(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if enrolled {
+		app.twoFactorChallengeResponse(w, r, user)
+		return
+	}
+
+	token, err := app.issueAuthenticationToken(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.recordLogin(r, user.Email, user, true)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+var errUnverifiedEmail = errors.New("unverified email")
+
+// userForIdentity returns the user linked to the external identity. Unknown
+// identities are linked to the user with the same verified email, or to a
+// newly registered user. Either way the user ends up activated, since the
+// provider has verified the email address. An unactivated account is taken
+// over with its credentials revoked, see claimUnactivatedUser.
+func (app *application) userForIdentity(provider string, claims *oidc.Claims) (*model.User, error) {
+	user, err := app.models.Identities.GetUser(provider, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, model.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if !claims.Verified() {
+		return nil, errUnverifiedEmail
+	}
+
+	user, err = app.models.Users.GetByEmail(claims.Email)
+	switch {
+	case errors.Is(err, model.ErrRecordNotFound):
+		user, err = app.registerExternalUser(claims)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case !user.Activated:
+		// Whoever registered the email never proved they own it, so
+		// nothing they set up may survive the link: their password and
+		// tokens are revoked before the account is activated.
+		err = app.models.Users.RevokeCredentials(user.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		err = claimUnactivatedUser(user)
+		if err != nil {
+			return nil, err
+		}
+
+		err = app.models.Users.Update(user)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = app.models.Identities.Link(provider, claims.Subject, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// claimUnactivatedUser hands an account that was registered but never
+// activated to the owner of its email address. The password is made
+// unusable, as it was chosen by whoever registered the account.
+func claimUnactivatedUser(user *model.User) error {
+	err := user.Password.SetUnusable()
+	if err != nil {
+		return err
+	}
+
+	user.Activated = true
+	return nil
+}
+
+func (app *application) registerExternalUser(claims *oidc.Claims) (*model.User, error) {
+	name := claims.Name
+	if name == "" {
+		name = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	user := &model.User{
+		Name:      name,
+		Email:     claims.Email,
+		Activated: true,
+	}
+
+	// The account has no usable password until the user sets one.
+	err := user.Password.SetUnusable()
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Permissions.AddForUser(user.Id, "games:read")
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/jsonlog"
+	"github.com/ermapula/golang-project/pkg/mailer"
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/oidc"
+)
+
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	return &application{
+		logger:         jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		mailer:         mailer.New("", 0, "", "", ""),
+		suggestLimiter: newRateLimiter(1, 1),
+		oidcProviders: map[string]*oidc.Provider{
+			"mock": oidc.NewProvider(oidc.Config{Name: "mock", Issuer: "http://127.0.0.1:0", ClientID: "client"},
+				"https://api.example.com/oauth/mock/callback"),
+		},
+	}
+}
+
+// The callback must come from the browser that started the login. These
+// cases are rejected before the state is looked up or the code exchanged.
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		want   int
+	}{
+		{name: "no cookie", want: http.StatusUnprocessableEntity},
+		{name: "other state", cookie: &http.Cookie{Name: oidcStateCookieName, Value: "attacker"}, want: http.StatusUnprocessableEntity},
+		{name: "empty cookie", cookie: &http.Cookie{Name: oidcStateCookieName, Value: ""}, want: http.StatusUnprocessableEntity},
+	}
+
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/oauth/mock/callback?code=abc&state=victim", nil)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestOIDCStateCookie(t *testing.T) {
+	provider := oidc.NewProvider(oidc.Config{Name: "mock"}, "https://api.example.com/oauth/mock/callback")
+
+	cookie := oidcStateCookie(provider, "state", time.Now().Add(time.Minute))
+
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("cookie is not locked down: %+v", cookie)
+	}
+	if cookie.Path != "/oauth/mock/callback" {
+		t.Fatalf("path = %q", cookie.Path)
+	}
+
+	insecure := oidc.NewProvider(oidc.Config{Name: "mock"}, "http://localhost:8080/oauth/mock/callback")
+	if oidcStateCookie(insecure, "state", time.Now().Add(time.Minute)).Secure {
+		t.Fatal("cookie must not be Secure for plain HTTP redirect URLs")
+	}
+}
+
+// Someone may register a victim's email before the victim first signs in
+// with a provider. Linking the identity must not leave that password working.
+func TestClaimUnactivatedUser(t *testing.T) {
+	user := &model.User{Name: "Squatter", Email: "victim@example.com"}
+
+	err := user.Password.Set("squatter-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = claimUnactivatedUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !user.Activated {
+		t.Fatal("user was not activated")
+	}
+
+	matches, err := user.Password.Matches("squatter-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matches {
+		t.Fatal("the registered password still works after the link")
+	}
+}
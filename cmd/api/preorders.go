@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+// preorderGame charges the user for a game that isn't out yet. The game is
+// added to their library once its release date passes.
+func (app *application) preorderGame(w http.ResponseWriter, r *http.Request, userID int64, game *model.Game) {
+	preorder := &model.Preorder{
+		UserId:      userID,
+		GameId:      game.Id,
+		Title:       game.Title,
+		ReleaseDate: game.ReleaseDate,
+		Price:       game.Price,
+	}
+
+	v := validator.New()
+
+	err := app.models.Preorders.Insert(preorder)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrDuplicatePreorder):
+			v.AddError("library", "game already pre-ordered")
+			app.failedValidatorResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrInsufficientFunds):
+			v.AddError("wallet", "insufficient funds")
+			app.failedValidatorResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"preorder": preorder}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listPreordersHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	preorders, err := app.models.Preorders.GetAllForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"preorders": preorders}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelPreorderHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	preorder, err := app.models.Preorders.Cancel(int64(id), user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrAlreadyReleased):
+			app.failedValidatorResponse(w, r, map[string]string{"preorder": "cannot be cancelled after the release date"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"preorder": preorder}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket per client IP address. Each client may make
+// burst requests at once, refilled at rate requests per second.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	clients map[string]*bucket
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// validateRateLimit checks the limits a rateLimiter is configured with. The
+// refill divides by the rate, so it has to be positive.
+func validateRateLimit(rate float64, burst int) error {
+	if !(rate > 0) || math.IsInf(rate, 0) {
+		return errors.New("rate limit must be a positive number of requests per second")
+	}
+	if burst < 1 {
+		return errors.New("rate limit burst must be at least 1")
+	}
+	return nil
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		clients: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from the client's bucket. If there is none left, it
+// returns how long the client has to wait for the next one.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	b, ok := l.clients[client]
+	if !ok {
+		b = &bucket{tokens: l.burst}
+		l.clients[client] = b
+	} else {
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*l.rate)
+	}
+	b.lastSeen = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// prune forgets clients that have been idle long enough for their bucket to
+// be full again.
+func (l *rateLimiter) prune() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idle := time.Duration(l.burst / l.rate * float64(time.Second))
+
+	for client, b := range l.clients {
+		if time.Since(b.lastSeen) > idle {
+			delete(l.clients, client)
+		}
+	}
+
+	return nil
+}
+
+func (app *application) rateLimit(limiter *rateLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := limiter.allow(clientIP(r)); !ok {
+			app.rateLimitExceededResponse(w, r, wait)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		burst   int
+		wantErr bool
+	}{
+		{name: "valid", rate: 5, burst: 20},
+		{name: "fractional rate", rate: 0.5, burst: 1},
+		{name: "zero rate", rate: 0, burst: 20, wantErr: true},
+		{name: "negative rate", rate: -1, burst: 20, wantErr: true},
+		{name: "NaN rate", rate: math.NaN(), burst: 20, wantErr: true},
+		{name: "infinite rate", rate: math.Inf(1), burst: 20, wantErr: true},
+		{name: "zero burst", rate: 5, burst: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRateLimit(tt.rate, tt.burst)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		// idle is how long the client waits after using up its burst.
+		idle        time.Duration
+		wantAllowed int
+	}{
+		{name: "no wait", rate: 1, burst: 3, wantAllowed: 0},
+		{name: "one token refilled", rate: 1, burst: 3, idle: 1100 * time.Millisecond, wantAllowed: 1},
+		{name: "fast refill", rate: 10, burst: 3, idle: 250 * time.Millisecond, wantAllowed: 2},
+		{name: "refill capped at burst", rate: 1, burst: 3, idle: time.Hour, wantAllowed: 3},
+		{name: "partial token", rate: 1, burst: 3, idle: 500 * time.Millisecond, wantAllowed: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.rate, tt.burst)
+
+			for i := 0; i < tt.burst; i++ {
+				if ok, _ := l.allow("10.0.0.1"); !ok {
+					t.Fatalf("request %d of the burst was limited", i+1)
+				}
+			}
+
+			l.clients["10.0.0.1"].lastSeen = l.clients["10.0.0.1"].lastSeen.Add(-tt.idle)
+
+			allowed := 0
+			for {
+				ok, wait := l.allow("10.0.0.1")
+				if !ok {
+					if wait <= 0 || wait > time.Duration(float64(time.Second)/tt.rate) {
+						t.Fatalf("wait = %v, want at most one token's time", wait)
+					}
+					break
+				}
+				allowed++
+			}
+
+			if allowed != tt.wantAllowed {
+				t.Fatalf("allowed %d more requests, want %d", allowed, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterClientsAreSeparate(t *testing.T) {
+	l := newRateLimiter(1, 1)
+
+	if ok, _ := l.allow("10.0.0.1"); !ok {
+		t.Fatal("first request was limited")
+	}
+	if ok, _ := l.allow("10.0.0.1"); ok {
+		t.Fatal("second request was allowed")
+	}
+	if ok, _ := l.allow("10.0.0.2"); !ok {
+		t.Fatal("other client was limited")
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	l := newRateLimiter(1, 5)
+
+	l.allow("idle")
+	l.allow("active")
+	l.clients["idle"].lastSeen = time.Now().Add(-6 * time.Second)
+
+	l.prune()
+
+	if _, ok := l.clients["idle"]; ok {
+		t.Error("idle client was kept")
+	}
+	if _, ok := l.clients["active"]; !ok {
+		t.Error("active client was pruned")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	app := newTestApplication(t)
+
+	handler := app.rateLimit(newRateLimiter(0.5, 1), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		remoteAddr     string
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{"10.0.0.1:1234", http.StatusNoContent, ""},
+		{"10.0.0.1:5678", http.StatusTooManyRequests, "2"},
+		{"10.0.0.2:1234", http.StatusNoContent, ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Fatalf("%s: status = %d, want %d", tt.remoteAddr, w.Code, tt.wantStatus)
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+			t.Fatalf("%s: Retry-After = %q, want %q", tt.remoteAddr, got, tt.wantRetryAfter)
+		}
+	}
+}
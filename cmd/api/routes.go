@@ -19,23 +19,115 @@ func (app *application) routes() http.Handler {
 	r.HandleFunc("/publishers/{id:[0-9]+}/games", app.getPublisherGames).Methods("GET")
 
 	r.HandleFunc("/games", app.requirePermission("games:read", app.getGames)).Methods("GET")
+	r.HandleFunc("/games/suggest", app.rateLimit(app.suggestLimiter, app.suggestGamesHandler)).Methods("GET")
 	r.HandleFunc("/games/{id:[0-9]+}", app.requirePermission("games:read", app.getGame)).Methods("GET")
-	r.HandleFunc("/games", app.requirePermission("games:write", app.requireActivatedUser(app.postGame))).Methods("POST")
-	r.HandleFunc("/games/{id:[0-9]+}", app.requirePermission("games:write", app.requireActivatedUser(app.updateGame))).Methods("PATCH")
-	r.HandleFunc("/games/{id:[0-9]+}", app.requirePermission("games:write", app.requireActivatedUser(app.deleteGame))).Methods("DELETE")
+	r.HandleFunc("/games", app.requirePermission("games:write", app.postGame)).Methods("POST")
+	r.HandleFunc("/games/{id:[0-9]+}", app.requirePermission("games:write", app.updateGame)).Methods("PATCH")
+	r.HandleFunc("/games/{id:[0-9]+}", app.requirePermission("games:write", app.deleteGame)).Methods("DELETE")
 
-	r.HandleFunc("/permissions", app.addPermission).Methods("POST")
+	r.HandleFunc("/games/{id:[0-9]+}/achievements", app.requirePermission("games:read", app.listGameAchievementsHandler)).Methods("GET")
+	r.HandleFunc("/games/{id:[0-9]+}/achievements", app.requirePermission("games:write", app.createAchievementHandler)).Methods("POST")
+	r.HandleFunc("/games/{id:[0-9]+}/tags", app.requirePermission("games:read", app.listGameTagsHandler)).Methods("GET")
+	r.HandleFunc("/games/{id:[0-9]+}/tags", app.requireActivatedUser(app.addGameTagHandler)).Methods("POST")
+	r.HandleFunc("/games/{id:[0-9]+}/tags/{tag_id:[0-9]+}", app.requireActivatedUser(app.removeGameTagHandler)).Methods("DELETE")
+
+	r.HandleFunc("/games/{id:[0-9]+}/includes/{included_id:[0-9]+}", app.requirePermission("games:write", app.addGameIncludeHandler)).Methods("PUT")
+	r.HandleFunc("/games/{id:[0-9]+}/includes/{included_id:[0-9]+}", app.requirePermission("games:write", app.removeGameIncludeHandler)).Methods("DELETE")
+
+	r.HandleFunc("/bundles", app.requirePermission("games:read", app.listBundlesHandler)).Methods("GET")
+	r.HandleFunc("/bundles", app.requirePermission("games:write", app.createBundleHandler)).Methods("POST")
+	r.HandleFunc("/bundles/{id:[0-9]+}", app.requirePermission("games:read", app.showBundleHandler)).Methods("GET")
+	r.HandleFunc("/bundles/{id:[0-9]+}", app.requirePermission("games:write", app.deleteBundleHandler)).Methods("DELETE")
+	r.HandleFunc("/bundles/{id:[0-9]+}/purchase", app.requireAuthenticatedUser(app.purchaseBundleHandler)).Methods("POST")
+
+	r.HandleFunc("/genres", app.listGenresHandler).Methods("GET")
+	r.HandleFunc("/genres", app.requirePermission("games:write", app.createGenreHandler)).Methods("POST")
+	r.HandleFunc("/genres/{id:[0-9]+}", app.requirePermission("games:write", app.updateGenreHandler)).Methods("PATCH")
+
+	r.HandleFunc("/permissions", app.requirePermission("admin", app.addPermission)).Methods("POST")
 
 	r.HandleFunc("/wallet", app.requireAuthenticatedUser(app.getWalletHandler)).Methods("GET")
 	r.HandleFunc("/wallet", app.requireAuthenticatedUser(app.updateWalletHandler)).Methods("PATCH")
 	r.HandleFunc("/library", app.requireAuthenticatedUser(app.showLibraryHandler)).Methods("GET")
 	r.HandleFunc("/library/{id:[0-9]+}", app.requireAuthenticatedUser(app.addLibraryHandler)).Methods("POST")
 	r.HandleFunc("/library/{id:[0-9]+}", app.requireAuthenticatedUser(app.removeLibraryHandler)).Methods("DELETE")
+	r.HandleFunc("/library/{id:[0-9]+}", app.requireAuthenticatedUser(app.updateLibraryEntryHandler)).Methods("PATCH")
+	r.HandleFunc("/library/{id:[0-9]+}/achievements", app.requireAuthenticatedUser(app.showLibraryAchievementsHandler)).Methods("GET")
+	r.HandleFunc("/library/{id:[0-9]+}/achievements/{aid:[0-9]+}", app.requireAuthenticatedUser(app.unlockAchievementHandler)).Methods("POST")
+	r.HandleFunc("/library/{id:[0-9]+}/lease", app.requireActivatedUser(app.checkoutGameHandler)).Methods("POST")
+	r.HandleFunc("/library/{id:[0-9]+}/lease", app.requireActivatedUser(app.returnGameHandler)).Methods("DELETE")
+	r.HandleFunc("/library/{id:[0-9]+}/sessions", app.requireAuthenticatedUser(app.addPlaySessionHandler)).Methods("POST")
+
+	r.HandleFunc("/preorders", app.requireAuthenticatedUser(app.listPreordersHandler)).Methods("GET")
+	r.HandleFunc("/preorders/{id:[0-9]+}", app.requireAuthenticatedUser(app.cancelPreorderHandler)).Methods("DELETE")
+
+	r.HandleFunc("/collections", app.requireAuthenticatedUser(app.listCollectionsHandler)).Methods("GET")
+	r.HandleFunc("/collections", app.requireAuthenticatedUser(app.createCollectionHandler)).Methods("POST")
+	r.HandleFunc("/collections/{id:[0-9]+}", app.requireAuthenticatedUser(app.showCollectionHandler)).Methods("GET")
+	r.HandleFunc("/collections/{id:[0-9]+}", app.requireAuthenticatedUser(app.updateCollectionHandler)).Methods("PATCH")
+	r.HandleFunc("/collections/{id:[0-9]+}", app.requireAuthenticatedUser(app.deleteCollectionHandler)).Methods("DELETE")
+	r.HandleFunc("/collections/{id:[0-9]+}/games/{game_id:[0-9]+}", app.requireAuthenticatedUser(app.addCollectionGameHandler)).Methods("PUT")
+	r.HandleFunc("/collections/{id:[0-9]+}/games/{game_id:[0-9]+}", app.requireAuthenticatedUser(app.removeCollectionGameHandler)).Methods("DELETE")
+
+	r.HandleFunc("/family", app.requireActivatedUser(app.showFamilyHandler)).Methods("GET")
+	r.HandleFunc("/family", app.requireActivatedUser(app.createFamilyHandler)).Methods("POST")
+	r.HandleFunc("/family", app.requireActivatedUser(app.deleteFamilyHandler)).Methods("DELETE")
+	r.HandleFunc("/family/members/{id:[0-9]+}", app.requireActivatedUser(app.removeFamilyMemberHandler)).Methods("DELETE")
+	r.HandleFunc("/family/invites", app.requireActivatedUser(app.listFamilyInvitesHandler)).Methods("GET")
+	r.HandleFunc("/family/invites", app.requireActivatedUser(app.createFamilyInviteHandler)).Methods("POST")
+	r.HandleFunc("/family/invites/{id:[0-9]+}/accept", app.requireActivatedUser(app.acceptFamilyInviteHandler)).Methods("POST")
+	r.HandleFunc("/family/invites/{id:[0-9]+}/decline", app.requireActivatedUser(app.declineFamilyInviteHandler)).Methods("POST")
+
+	r.HandleFunc("/friends", app.requireActivatedUser(app.listFriendsHandler)).Methods("GET")
+	r.HandleFunc("/friends/{id:[0-9]+}", app.requireActivatedUser(app.removeFriendHandler)).Methods("DELETE")
+	r.HandleFunc("/friends/{id:[0-9]+}/games", app.requireActivatedUser(app.showFriendGamesHandler)).Methods("GET")
+	r.HandleFunc("/friends/requests", app.requireActivatedUser(app.listFriendRequestsHandler)).Methods("GET")
+	r.HandleFunc("/friends/requests", app.requireActivatedUser(app.sendFriendRequestHandler)).Methods("POST")
+	r.HandleFunc("/friends/requests/{id:[0-9]+}/accept", app.requireActivatedUser(app.acceptFriendRequestHandler)).Methods("POST")
+	r.HandleFunc("/friends/requests/{id:[0-9]+}/decline", app.requireActivatedUser(app.declineFriendRequestHandler)).Methods("POST")
+	r.HandleFunc("/blocks", app.requireActivatedUser(app.listBlockedUsersHandler)).Methods("GET")
+	r.HandleFunc("/blocks", app.requireActivatedUser(app.blockUserHandler)).Methods("POST")
+	r.HandleFunc("/blocks/{id:[0-9]+}", app.requireActivatedUser(app.unblockUserHandler)).Methods("DELETE")
 
 	r.HandleFunc("/users", app.registerUserHandler).Methods("POST")
 	r.HandleFunc("/users/activated", app.activateUserHandler).Methods("PUT")
+	r.HandleFunc("/users/password", app.resetPasswordHandler).Methods("PUT")
+	r.HandleFunc("/users/me", app.requireAuthenticatedUser(app.showCurrentUserHandler)).Methods("GET")
+	r.HandleFunc("/users/me", app.requireAuthenticatedUser(app.updateCurrentUserHandler)).Methods("PATCH")
+	r.HandleFunc("/users/me", app.requireAuthenticatedUser(app.deleteCurrentUserHandler)).Methods("DELETE")
+	r.HandleFunc("/users/{id:[0-9]+}/profile", app.showUserProfileHandler).Methods("GET")
+	r.HandleFunc("/users/me/password", app.requireAuthenticatedUser(app.updateCurrentUserPasswordHandler)).Methods("PUT")
+	r.HandleFunc("/users/me/export", app.requireAuthenticatedUser(app.createDataExportHandler)).Methods("POST")
+	r.HandleFunc("/users/me/export/{id:[0-9]+}", app.requireAuthenticatedUser(app.showDataExportHandler)).Methods("GET")
+	r.HandleFunc("/users/me/export/{id:[0-9]+}/download", app.requireAuthenticatedUser(app.downloadDataExportHandler)).Methods("GET")
+	r.HandleFunc("/users/me/logins", app.requireAuthenticatedUser(app.listLoginEventsHandler)).Methods("GET")
+	r.HandleFunc("/users/2fa/setup", app.requireActivatedUser(app.setupTwoFactorHandler)).Methods("POST")
+	r.HandleFunc("/users/2fa/confirm", app.requireActivatedUser(app.confirmTwoFactorHandler)).Methods("POST")
 
 	r.HandleFunc("/tokens/authentication", app.createAuthenticationTokenHandler).Methods("POST")
+	r.HandleFunc("/tokens/2fa", app.createTwoFactorTokenHandler).Methods("POST")
+
+	r.HandleFunc("/oauth/{provider}/login", app.oidcLoginHandler).Methods("GET")
+	r.HandleFunc("/oauth/{provider}/callback", app.oidcCallbackHandler).Methods("GET")
+
+	r.HandleFunc("/api-keys", app.requireActivatedUser(app.listAPIKeysHandler)).Methods("GET")
+	r.HandleFunc("/api-keys", app.requireActivatedUser(app.createAPIKeyHandler)).Methods("POST")
+	r.HandleFunc("/api-keys/{id:[0-9]+}", app.requireActivatedUser(app.revokeAPIKeyHandler)).Methods("DELETE")
+
+	r.HandleFunc("/admin/games/import", app.requirePermission("admin", app.importGamesHandler)).Methods("POST")
+	r.HandleFunc("/admin/games/export", app.requirePermission("admin", app.exportGamesHandler)).Methods("GET")
+	r.HandleFunc("/admin/games/{id:[0-9]+}/restore", app.requirePermission("admin", app.restoreGameAdminHandler)).Methods("POST")
+	r.HandleFunc("/admin/games/{id:[0-9]+}", app.requirePermission("admin", app.purgeGameAdminHandler)).Methods("DELETE")
+	r.HandleFunc("/admin/users", app.requirePermission("admin", app.listUsersAdminHandler)).Methods("GET")
+	r.HandleFunc("/admin/users/{id:[0-9]+}", app.requirePermission("admin", app.showUserAdminHandler)).Methods("GET")
+	r.HandleFunc("/admin/users/{id:[0-9]+}/activate", app.requirePermission("admin", app.activateUserAdminHandler)).Methods("POST")
+	r.HandleFunc("/admin/users/{id:[0-9]+}/deactivate", app.requirePermission("admin", app.deactivateUserAdminHandler)).Methods("POST")
+	r.HandleFunc("/admin/users/{id:[0-9]+}/ban", app.requirePermission("admin", app.banUserAdminHandler)).Methods("POST")
+	r.HandleFunc("/admin/users/{id:[0-9]+}/unban", app.requirePermission("admin", app.unsuspendUserAdminHandler)).Methods("POST")
+	r.HandleFunc("/admin/users/{id:[0-9]+}/suspend", app.requirePermission("admin", app.suspendUserAdminHandler)).Methods("POST")
+	r.HandleFunc("/admin/users/{id:[0-9]+}/unsuspend", app.requirePermission("admin", app.unsuspendUserAdminHandler)).Methods("POST")
+	r.HandleFunc("/admin/users/{id:[0-9]+}/password-reset", app.requirePermission("admin", app.resetPasswordAdminHandler)).Methods("POST")
+	r.HandleFunc("/admin/users/{id:[0-9]+}/wallet", app.requirePermission("admin", app.adjustWalletAdminHandler)).Methods("POST")
 
 	return app.recoverPanic(app.authenticate(r))
 }
\ No newline at end of file
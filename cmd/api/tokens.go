@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/ermapula/golang-project/pkg/jwt"
 	"github.com/ermapula/golang-project/pkg/model"
 	"github.com/ermapula/golang-project/pkg/validator"
 )
@@ -13,6 +14,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	var input struct {
 		Email string `json:"email"`
 		Password string `json:"password"`
+		Code string `json:"code"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -31,10 +33,22 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	wait, err := app.loginLockout(input.Email, clientIP(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
+			app.recordLogin(r, input.Email, nil, false)
 			app.invalidCredentialsResponse(w, r)
 			return
 		default:
@@ -50,18 +64,81 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	if !match {
+		app.recordLogin(r, input.Email, user, false)
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.Id, 24*time.Hour, model.ScopeAuthentication)
+	if user.IsSuspended() {
+		app.suspendedAccountResponse(w, r, user)
+		return
+	}
+
+	enrolled, err := app.models.TwoFactor.Enabled(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if enrolled {
+		if input.Code == "" {
+			app.twoFactorChallengeResponse(w, r, user)
+			return
+		}
+
+		ok, err := app.verifySecondFactor(user.Id, input.Code)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !ok {
+			app.recordLogin(r, input.Email, user, false)
+			app.invalidTwoFactorCodeResponse(w, r)
+			return
+		}
+	}
+
+	token, err := app.issueAuthenticationToken(user)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	app.recordLogin(r, input.Email, user, true)
+
 	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
-}
\ No newline at end of file
+}
+
+func (app *application) issueAuthenticationToken(user *model.User) (*model.Token, error) {
+	if app.jwtKeys != nil {
+		return app.newJWTToken(user)
+	}
+
+	return app.models.Tokens.New(user.Id, 24*time.Hour, model.ScopeAuthentication)
+}
+
+func (app *application) newJWTToken(user *model.User) (*model.Token, error) {
+	now := time.Now()
+	expiry := now.Add(app.config.jwt.ttl)
+
+	plaintext, err := app.jwtKeys.Sign(jwt.Claims{
+		Subject:    user.Id,
+		Generation: user.TokenGeneration,
+		IssuedAt:   now.Unix(),
+		Expiry:     expiry.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Token{
+		Plaintext: plaintext,
+		UserID:    user.Id,
+		Expiry:    expiry,
+		Scope:     model.ScopeAuthentication,
+	}, nil
+}
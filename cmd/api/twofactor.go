@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/model"
+	"github.com/ermapula/golang-project/pkg/totp"
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+func (app *application) setupTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	tf, err := app.models.TwoFactor.Setup(user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.failedValidatorResponse(w, r, map[string]string{"2fa": "two-factor authentication is already enabled"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"secret": totp.EncodeSecret(tf.Secret),
+		"uri":    totp.URI("golang-project", user.Email, tf.Secret),
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"two_factor": data}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateTwoFactorCode(v, input.Code); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	tf, err := app.models.TwoFactor.Get(user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("2fa", "two-factor setup has not been started")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if tf.Confirmed {
+		v.AddError("2fa", "two-factor authentication is already enabled")
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	ok, err := app.models.TwoFactor.Verify(tf, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.invalidTwoFactorCodeResponse(w, r)
+		return
+	}
+
+	codes, err := app.models.TwoFactor.Confirm(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createTwoFactorTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		Code           string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	model.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	model.ValidateTwoFactorCode(v, input.Code)
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(model.ScopeTwoFactor, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired two-factor token")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	wait, err := app.loginLockout(user.Email, clientIP(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return
+	}
+
+	ok, err := app.verifySecondFactor(user.Id, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.recordLogin(r, user.Email, user, false)
+		app.invalidTwoFactorCodeResponse(w, r)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(model.ScopeTwoFactor, user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.issueAuthenticationToken(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.recordLogin(r, user.Email, user, true)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// twoFactorChallengeResponse answers a correct password for an enrolled user
+// with a short-lived token that has to be completed at POST /tokens/2fa.
+func (app *application) twoFactorChallengeResponse(w http.ResponseWriter, r *http.Request, user *model.User) {
+	token, err := app.models.Tokens.New(user.Id, 5*time.Minute, model.ScopeTwoFactor)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"two_factor_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code.
+func (app *application) verifySecondFactor(userID int64, code string) (bool, error) {
+	if len(code) != totp.Digits {
+		return app.models.TwoFactor.UseRecoveryCode(userID, code)
+	}
+
+	tf, err := app.models.TwoFactor.Get(userID)
+	if err != nil {
+		if errors.Is(err, model.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !tf.Confirmed {
+		return false, nil
+	}
+
+	return app.models.TwoFactor.Verify(tf, code)
+}
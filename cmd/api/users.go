@@ -162,4 +162,427 @@ func (app *application) addPermission(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
-}
\ No newline at end of file
+}
+
+func (app *application) showUserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	viewer := app.contextGetUser(r)
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !viewer.IsAnonymous() && viewer.Id != user.Id {
+		blocked, err := app.models.Friends.IsBlocked(viewer.Id, user.Id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if blocked {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+
+	profile := &model.Profile{
+		PublicUser: model.PublicUser{Id: user.Id, Name: user.Name},
+		JoinedAt:   user.CreatedAt,
+		Privacy:    user.LibraryPrivacy,
+	}
+
+	visible, err := app.canViewLibrary(viewer, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if visible {
+		games, err := app.models.Games.GetAllOfUser(user.Id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		count := len(games)
+		profile.GameCount = &count
+		profile.Library = games
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"profile": profile}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name           *string `json:"name"`
+		Email          *string `json:"email"`
+		LibraryPrivacy *string `json:"library_privacy"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	emailChanged := false
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.Email != nil && *input.Email != user.Email {
+		user.Email = *input.Email
+		user.Activated = false
+		emailChanged = true
+	}
+
+	if input.LibraryPrivacy != nil {
+		user.LibraryPrivacy = *input.LibraryPrivacy
+	}
+
+	v := validator.New()
+
+	model.ValidateUser(v, user)
+	model.ValidatePrivacy(v, "library_privacy", user.LibraryPrivacy)
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.UpdateProfile(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidatorResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !emailChanged {
+		err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A new email address has to be confirmed like on registration.
+	err = app.models.Tokens.DeleteAllForUser(model.ScopeActivation, user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.Id, 3*24*time.Hour, model.ScopeActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := struct {
+		Token *string     `json:"token"`
+		User  *model.User `json:"user"`
+	}{
+		Token: &token.Plaintext,
+		User:  user,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": data}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reauthenticationWindow is how recent a login has to be to count as proof
+// of identity on its own.
+const reauthenticationWindow = 5 * time.Minute
+
+// reauthenticate makes the user prove who they are before a sensitive
+// change, with their password, a two-factor code, or a login within the
+// reauthenticationWindow. The last one is how users who sign in with an
+// external provider, and have no usable password, get through. It writes
+// the error response and returns false if the user couldn't prove it.
+func (app *application) reauthenticate(w http.ResponseWriter, r *http.Request, user *model.User, password, code string) bool {
+	var ok bool
+	var err error
+
+	switch {
+	case password != "":
+		ok, err = user.Password.Matches(password)
+	case code != "":
+		ok, err = app.verifySecondFactor(user.Id, code)
+	default:
+		ok, err = app.recentlyAuthenticated(r)
+		if err == nil && !ok {
+			app.reauthenticationRequiredResponse(w, r)
+			return false
+		}
+	}
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !ok {
+		app.invalidCredentialsResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// recentlyAuthenticated reports whether the token of the request was issued
+// within the reauthenticationWindow.
+func (app *application) recentlyAuthenticated(r *http.Request) (bool, error) {
+	issuedAt, ok := app.contextGetIssuedAt(r)
+	if !ok {
+		token := app.contextGetToken(r)
+		if token == "" {
+			return false, nil
+		}
+
+		var err error
+		issuedAt, err = app.models.Tokens.IssuedAt(model.ScopeAuthentication, token)
+		if err != nil {
+			if errors.Is(err, model.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+
+	return time.Since(issuedAt) <= reauthenticationWindow, nil
+}
+
+func (app *application) updateCurrentUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidatePasswordPlaintext(v, input.NewPassword); !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.reauthenticate(w, r, user, input.CurrentPassword, input.Code) {
+		return
+	}
+
+	err = user.Password.Set(input.NewPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Keep the session that made this request and sign out everywhere else.
+	current := app.contextGetToken(r)
+
+	err = app.models.Tokens.DeleteAllForUserExcept(model.ScopeAuthentication, user.Id, current)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.RevokeJWTs(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := envelope{"message": "your password was successfully updated"}
+
+	// A request made with a JWT has just revoked its own token, so hand out
+	// a new one to stay signed in.
+	if current == "" {
+		token, err := app.issueAuthenticationToken(user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		response["authentication_token"] = token
+	}
+
+	err = app.writeJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !app.reauthenticate(w, r, user, input.Password, input.Code) {
+		return
+	}
+
+	err = app.models.Users.SoftDelete(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account was successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	model.ValidatePasswordPlaintext(v, input.Password)
+	model.ValidateTokenPlaintext(v, input.TokenPlaintext)
+
+	if !v.Valid() {
+		app.failedValidatorResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(model.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidatorResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Whoever knew the old password may still hold a session, an API key or
+	// a JWT, so all of them go along with the reset token.
+	err = app.models.Users.RevokeCredentials(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
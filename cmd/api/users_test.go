@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/model"
+)
+
+func TestReauthenticate(t *testing.T) {
+	user := &model.User{Id: 1}
+	if err := user.Password.Set("pa55word1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		issuedAt   time.Duration
+		password   string
+		wantOK     bool
+		wantStatus int
+	}{
+		{name: "password", issuedAt: -time.Hour, password: "pa55word1234", wantOK: true},
+		{name: "wrong password", issuedAt: -time.Minute, password: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "fresh login", issuedAt: -time.Minute, wantOK: true},
+		{name: "stale login", issuedAt: -time.Hour, wantStatus: http.StatusUnauthorized},
+	}
+
+	app := newTestApplication(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/users/me", nil)
+			r = app.contextSetIssuedAt(r, time.Now().Add(tt.issuedAt))
+
+			w := httptest.NewRecorder()
+
+			ok := app.reauthenticate(w, r, user, tt.password, "")
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v: %s", ok, tt.wantOK, w.Body.String())
+			}
+			if !ok && w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestKey(t *testing.T, id, algorithm string) *Key {
+	t.Helper()
+
+	material := bytes.Repeat([]byte(id[:1]), 32)
+
+	key, err := NewKey(id, algorithm, material)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func newTestKeySet(t *testing.T, active string, keys ...*Key) *KeySet {
+	t.Helper()
+
+	ks, err := NewKeySet(active, keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ks
+}
+
+func validClaims() Claims {
+	return Claims{
+		Subject:    42,
+		Generation: 3,
+		IssuedAt:   time.Now().Unix(),
+		Expiry:     time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{AlgHS256, AlgEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			ks := newTestKeySet(t, "a", newTestKey(t, "a", algorithm))
+
+			token, err := ks.Sign(validClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !IsJWT(token) {
+				t.Fatalf("%q is not recognised as a JWT", token)
+			}
+
+			claims, err := ks.Verify(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if claims.Subject != 42 || claims.Generation != 3 {
+				t.Fatalf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	hs := newTestKey(t, "a", AlgHS256)
+	ed := newTestKey(t, "b", AlgEdDSA)
+
+	signer := newTestKeySet(t, "a", hs, ed)
+	valid, _ := signer.Sign(validClaims())
+
+	expiredClaims := validClaims()
+	expiredClaims.Expiry = time.Now().Add(-time.Second).Unix()
+	expired, _ := signer.Sign(expiredClaims)
+
+	parts := strings.Split(valid, ".")
+
+	// A token that claims the HS256 key but is signed as EdDSA, or the
+	// other way around, must not be accepted.
+	wrongAlg := encoding.EncodeToString([]byte(`{"alg":"EdDSA","typ":"JWT","kid":"a"}`)) + "." + parts[1] + "." + parts[2]
+	noneAlg := encoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT","kid":"a"}`)) + "." + parts[1] + "."
+
+	tampered := parts[0] + "." + encoding.EncodeToString([]byte(`{"sub":1,"exp":9999999999}`)) + "." + parts[2]
+
+	tests := []struct {
+		name     string
+		verifier *KeySet
+		token    string
+		wantErr  error
+	}{
+		{name: "valid", verifier: signer, token: valid},
+		{name: "old key still verifies", verifier: newTestKeySet(t, "b", hs, ed), token: valid},
+		{name: "unknown key", verifier: newTestKeySet(t, "b", ed), token: valid, wantErr: ErrUnknownKey},
+		{name: "expired", verifier: signer, token: expired, wantErr: ErrExpiredToken},
+		{name: "tampered claims", verifier: signer, token: tampered, wantErr: ErrInvalidToken},
+		{name: "algorithm mismatch", verifier: signer, token: wrongAlg, wantErr: ErrInvalidToken},
+		{name: "alg none", verifier: signer, token: noneAlg, wantErr: ErrInvalidToken},
+		{name: "two parts", verifier: signer, token: parts[0] + "." + parts[1], wantErr: ErrInvalidToken},
+		{name: "bad header", verifier: signer, token: "!!." + parts[1] + "." + parts[2], wantErr: ErrInvalidToken},
+		{name: "opaque token", verifier: signer, token: "ABCDEFGHIJKLMNOPQRSTUVWXYZ", wantErr: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.verifier.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		algorithm string
+		material  []byte
+		wantErr   bool
+	}{
+		{name: "hs256", id: "a", algorithm: AlgHS256, material: make([]byte, 32)},
+		{name: "long hs256", id: "a", algorithm: AlgHS256, material: make([]byte, 64)},
+		{name: "short hs256", id: "a", algorithm: AlgHS256, material: make([]byte, 31), wantErr: true},
+		{name: "eddsa", id: "a", algorithm: AlgEdDSA, material: make([]byte, 32)},
+		{name: "long eddsa seed", id: "a", algorithm: AlgEdDSA, material: make([]byte, 64), wantErr: true},
+		{name: "unknown algorithm", id: "a", algorithm: "RS256", material: make([]byte, 32), wantErr: true},
+		{name: "no id", algorithm: AlgHS256, material: make([]byte, 32), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKey(tt.id, tt.algorithm, tt.material)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseKeySet(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	tests := []struct {
+		name    string
+		active  string
+		spec    string
+		wantErr bool
+	}{
+		{name: "one key", active: "a", spec: "a:HS256:" + secret},
+		{name: "rotation", active: "b", spec: "a:HS256:" + secret + ", b:EdDSA:" + secret},
+		{name: "trailing comma", active: "a", spec: "a:HS256:" + secret + ","},
+		{name: "inactive key only", active: "b", spec: "a:HS256:" + secret, wantErr: true},
+		{name: "duplicate id", active: "a", spec: "a:HS256:" + secret + ",a:EdDSA:" + secret, wantErr: true},
+		{name: "missing part", active: "a", spec: "a:" + secret, wantErr: true},
+		{name: "bad base64", active: "a", spec: "a:HS256:%%%", wantErr: true},
+		{name: "empty", active: "a", spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKeySet(tt.active, tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNotConfigured = errors.New("mailer: no SMTP server configured")
+
+// Mailer sends plain text emails through an SMTP server.
+type Mailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+}
+
+// New returns a mailer for the SMTP server at host:port. An empty host
+// returns a mailer whose Send always fails with ErrNotConfigured.
+func New(host string, port int, username, password, sender string) *Mailer {
+	if host == "" {
+		return &Mailer{}
+	}
+
+	m := &Mailer{
+		addr:   net.JoinHostPort(host, strconv.Itoa(port)),
+		sender: sender,
+	}
+
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m
+}
+
+// Configured reports whether the mailer has an SMTP server to send through.
+func (m *Mailer) Configured() bool {
+	return m.addr != ""
+}
+
+// Send delivers a message to a single recipient.
+func (m *Mailer) Send(recipient, subject, body string) error {
+	if m.addr == "" {
+		return ErrNotConfigured
+	}
+
+	if strings.ContainsAny(recipient, "\r\n") {
+		return fmt.Errorf("mailer: invalid recipient %q", recipient)
+	}
+
+	var msg bytes.Buffer
+
+	fmt.Fprintf(&msg, "From: %s\r\n", m.sender)
+	fmt.Fprintf(&msg, "To: %s\r\n", recipient)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return smtp.SendMail(m.addr, m.auth, m.sender, []string{recipient}, msg.Bytes())
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNotConfigured(t *testing.T) {
+	tests := []struct {
+		host       string
+		configured bool
+	}{
+		{host: "", configured: false},
+		{host: "smtp.example.com", configured: true},
+	}
+
+	for _, tt := range tests {
+		m := New(tt.host, 587, "", "", "store@example.com")
+
+		if m.Configured() != tt.configured {
+			t.Errorf("host %q: Configured = %v, want %v", tt.host, m.Configured(), tt.configured)
+		}
+	}
+
+	err := New("", 587, "", "", "").Send("gamer@example.com", "Hello", "Hi")
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("err = %v, want ErrNotConfigured", err)
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	m := New("127.0.0.1", 1, "", "", "store@example.com")
+
+	err := m.Send("gamer@example.com\r\nBcc: everyone@example.com", "Hello", "Hi")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
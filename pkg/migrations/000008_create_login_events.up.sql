@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS login_events (
+    id bigserial PRIMARY KEY,
+    user_id bigint REFERENCES users ON DELETE CASCADE,
+    email citext NOT NULL,
+    ip text NOT NULL,
+    user_agent text NOT NULL,
+    success bool NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS login_events_email_idx ON login_events (email, created_at);
+CREATE INDEX IF NOT EXISTS login_events_ip_idx ON login_events (ip, created_at);
+CREATE INDEX IF NOT EXISTS login_events_user_id_idx ON login_events (user_id, created_at);
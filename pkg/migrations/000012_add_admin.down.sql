@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code = 'admin';
+DROP TABLE IF EXISTS wallet_adjustments;
+ALTER TABLE users DROP COLUMN IF EXISTS ban_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS banned_at;
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS suspended_until;
+ALTER TABLE users RENAME COLUMN suspension_reason TO ban_reason;
+ALTER TABLE users RENAME COLUMN suspended_at TO banned_at;
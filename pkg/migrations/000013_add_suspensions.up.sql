@@ -0,0 +1,3 @@
+ALTER TABLE users RENAME COLUMN banned_at TO suspended_at;
+ALTER TABLE users RENAME COLUMN ban_reason TO suspension_reason;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_until timestamp(0) with time zone;
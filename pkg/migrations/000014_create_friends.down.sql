@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS blocks;
+DROP TABLE IF EXISTS friend_requests;
+ALTER TABLE users DROP COLUMN IF EXISTS library_privacy;
@@ -0,0 +1,21 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS library_privacy text NOT NULL DEFAULT 'friends';
+
+CREATE TABLE IF NOT EXISTS friend_requests (
+    id bigserial PRIMARY KEY,
+    requester_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    addressee_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    status text NOT NULL DEFAULT 'pending',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    accepted_at timestamp(0) with time zone,
+    CHECK (requester_id <> addressee_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS friend_requests_pair_idx
+    ON friend_requests (LEAST(requester_id, addressee_id), GREATEST(requester_id, addressee_id));
+
+CREATE TABLE IF NOT EXISTS blocks (
+    blocker_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    blocked_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS play_sessions;
+ALTER TABLE library DROP COLUMN IF EXISTS last_played_at;
+ALTER TABLE library DROP COLUMN IF EXISTS playtime_seconds;
@@ -0,0 +1,16 @@
+ALTER TABLE library ADD COLUMN IF NOT EXISTS playtime_seconds bigint NOT NULL DEFAULT 0;
+ALTER TABLE library ADD COLUMN IF NOT EXISTS last_played_at timestamp(0) with time zone;
+
+CREATE TABLE IF NOT EXISTS play_sessions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    game_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    started_at timestamp(0) with time zone NOT NULL,
+    ended_at timestamp(0) with time zone NOT NULL,
+    duration_seconds bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CHECK (ended_at > started_at),
+    CHECK (duration_seconds > 0)
+);
+
+CREATE INDEX IF NOT EXISTS play_sessions_user_game_idx ON play_sessions (user_id, game_id, started_at);
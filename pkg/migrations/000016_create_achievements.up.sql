@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS achievements (
+    id bigserial PRIMARY KEY,
+    game_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    icon_url text NOT NULL DEFAULT '',
+    hidden boolean NOT NULL DEFAULT false,
+    points integer NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (game_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS user_achievements (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    achievement_id bigint NOT NULL REFERENCES achievements ON DELETE CASCADE,
+    unlocked_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, achievement_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_achievements_achievement_idx ON user_achievements (achievement_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS collection_games;
+DROP TABLE IF EXISTS collections;
+ALTER TABLE library DROP COLUMN IF EXISTS hidden;
+ALTER TABLE library DROP COLUMN IF EXISTS favorite;
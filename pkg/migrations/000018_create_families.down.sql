@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS game_leases;
+DROP TABLE IF EXISTS family_invites;
+DROP TABLE IF EXISTS family_members;
+DROP TABLE IF EXISTS families;
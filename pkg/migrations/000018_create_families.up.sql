@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS families (
+    id bigserial PRIMARY KEY,
+    owner_id bigint NOT NULL UNIQUE REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS family_members (
+    family_id bigint NOT NULL REFERENCES families ON DELETE CASCADE,
+    user_id bigint NOT NULL UNIQUE REFERENCES users ON DELETE CASCADE,
+    joined_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (family_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS family_invites (
+    id bigserial PRIMARY KEY,
+    family_id bigint NOT NULL REFERENCES families ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (family_id, user_id)
+);
+
+-- A lease is a member borrowing another member's copy of a game. Each copy
+-- can only be lent to one member at a time.
+CREATE TABLE IF NOT EXISTS game_leases (
+    family_id bigint NOT NULL REFERENCES families ON DELETE CASCADE,
+    lender_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    game_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    borrower_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp(0) with time zone NOT NULL,
+    PRIMARY KEY (lender_id, game_id)
+);
+
+CREATE INDEX IF NOT EXISTS game_leases_borrower_idx ON game_leases (borrower_id, game_id);
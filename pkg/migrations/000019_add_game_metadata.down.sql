@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS games_platforms_idx;
+ALTER TABLE games DROP COLUMN IF EXISTS trailers;
+ALTER TABLE games DROP COLUMN IF EXISTS screenshots;
+ALTER TABLE games DROP COLUMN IF EXISTS system_requirements;
+ALTER TABLE games DROP COLUMN IF EXISTS min_age;
+ALTER TABLE games DROP COLUMN IF EXISTS age_rating;
+ALTER TABLE games DROP COLUMN IF EXISTS languages;
+ALTER TABLE games DROP COLUMN IF EXISTS platforms;
+ALTER TABLE games DROP COLUMN IF EXISTS developer;
+ALTER TABLE games DROP COLUMN IF EXISTS description;
+ALTER TABLE games DROP COLUMN IF EXISTS short_description;
@@ -0,0 +1,14 @@
+ALTER TABLE games ADD COLUMN IF NOT EXISTS short_description text NOT NULL DEFAULT '';
+ALTER TABLE games ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '';
+ALTER TABLE games ADD COLUMN IF NOT EXISTS developer text NOT NULL DEFAULT '';
+ALTER TABLE games ADD COLUMN IF NOT EXISTS platforms text[] NOT NULL DEFAULT '{}';
+ALTER TABLE games ADD COLUMN IF NOT EXISTS languages text[] NOT NULL DEFAULT '{}';
+-- Stored as the rating system and rating, e.g. 'PEGI 16' or 'ESRB T'.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS age_rating text;
+-- Minimum player age implied by the rating, kept for filtering.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS min_age integer;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS system_requirements jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE games ADD COLUMN IF NOT EXISTS screenshots text[] NOT NULL DEFAULT '{}';
+ALTER TABLE games ADD COLUMN IF NOT EXISTS trailers text[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS games_platforms_idx ON games USING GIN (platforms);
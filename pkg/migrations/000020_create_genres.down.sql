@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS game_tags;
+DROP TABLE IF EXISTS tags;
+DROP INDEX IF EXISTS games_genres_idx;
+UPDATE games SET genres = array_replace(array_replace(genres, 'open-world', 'open world'), 'battle-royale', 'battle royale');
+DROP TABLE IF EXISTS genres;
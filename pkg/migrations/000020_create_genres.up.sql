@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    slug text NOT NULL UNIQUE,
+    name text NOT NULL,
+    parent_id bigint REFERENCES genres ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO genres (slug, name)
+VALUES
+    ('action', 'Action'),
+    ('adventure', 'Adventure'),
+    ('shooter', 'Shooter'),
+    ('rpg', 'Role-playing'),
+    ('puzzle', 'Puzzle'),
+    ('platform', 'Platformer'),
+    ('open-world', 'Open world')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genres (slug, name, parent_id)
+VALUES
+    ('stealth', 'Stealth', (SELECT id FROM genres WHERE slug = 'action')),
+    ('action-adventure', 'Action-adventure', (SELECT id FROM genres WHERE slug = 'adventure')),
+    ('fps', 'First-person shooter', (SELECT id FROM genres WHERE slug = 'shooter')),
+    ('battle-royale', 'Battle royale', (SELECT id FROM genres WHERE slug = 'shooter')),
+    ('action-rpg', 'Action RPG', (SELECT id FROM genres WHERE slug = 'rpg'))
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genres (slug, name, parent_id)
+VALUES
+    ('souls-like', 'Souls-like', (SELECT id FROM genres WHERE slug = 'action-rpg'))
+ON CONFLICT DO NOTHING;
+
+-- Games store genre slugs from now on.
+UPDATE games SET genres = array_replace(array_replace(genres, 'open world', 'open-world'), 'battle royale', 'battle-royale');
+
+CREATE INDEX IF NOT EXISTS games_genres_idx ON games USING GIN (genres);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    slug text NOT NULL UNIQUE,
+    name text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS game_tags (
+    game_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (game_id, tag_id, user_id)
+);
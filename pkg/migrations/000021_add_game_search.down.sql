@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS games_title_trgm_idx;
+DROP INDEX IF EXISTS games_search_idx;
+ALTER TABLE games DROP COLUMN IF EXISTS search;
@@ -0,0 +1,10 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Titles weigh more than descriptions when ranking search results.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS search tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', description), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS games_search_idx ON games USING GIN (search);
+CREATE INDEX IF NOT EXISTS games_title_trgm_idx ON games USING GIN (title gin_trgm_ops);
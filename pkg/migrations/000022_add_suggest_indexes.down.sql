@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS genres_name_trgm_idx;
+DROP INDEX IF EXISTS publishers_name_trgm_idx;
+DROP INDEX IF EXISTS library_game_id_idx;
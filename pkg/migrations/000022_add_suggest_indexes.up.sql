@@ -0,0 +1,4 @@
+-- Suggestions are ranked by how many users own a game.
+CREATE INDEX IF NOT EXISTS library_game_id_idx ON library (game_id);
+CREATE INDEX IF NOT EXISTS publishers_name_trgm_idx ON publishers USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS genres_name_trgm_idx ON genres USING GIN (name gin_trgm_ops);
@@ -0,0 +1,2 @@
+-- External identifier of a game in the publisher's catalog, used by imports.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS sku text UNIQUE;
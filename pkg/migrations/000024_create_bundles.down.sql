@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS bundle_games;
+DROP TABLE IF EXISTS bundles;
+DROP TABLE IF EXISTS game_includes;
+DROP INDEX IF EXISTS games_base_game_id_idx;
+ALTER TABLE games DROP COLUMN IF EXISTS base_game_id;
+ALTER TABLE games DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,39 @@
+-- A game is a base game, a DLC of a base game, or an edition that includes
+-- other games and DLC.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS kind text NOT NULL DEFAULT 'game';
+ALTER TABLE games ADD COLUMN IF NOT EXISTS base_game_id bigint REFERENCES games;
+
+CREATE INDEX IF NOT EXISTS games_base_game_id_idx ON games (base_game_id);
+
+CREATE TABLE IF NOT EXISTS game_includes (
+    game_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    included_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    PRIMARY KEY (game_id, included_id),
+    CHECK (game_id <> included_id)
+);
+
+CREATE TABLE IF NOT EXISTS bundles (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    discount_percent integer NOT NULL DEFAULT 0 CHECK (discount_percent BETWEEN 0 AND 100),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS bundle_games (
+    bundle_id bigint NOT NULL REFERENCES bundles ON DELETE CASCADE,
+    game_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    PRIMARY KEY (bundle_id, game_id)
+);
+
+UPDATE games d
+SET kind = 'dlc', base_game_id = b.id
+FROM (SELECT id FROM games WHERE title = 'Bloodborne' ORDER BY id LIMIT 1) b
+WHERE d.title = 'Bloodborne: The Old Hunters';
+
+UPDATE games SET kind = 'edition' WHERE title = 'Sekiro: Shadows Die Twice - Game of the Year Edition';
+
+INSERT INTO game_includes (game_id, included_id)
+SELECT e.id, b.id
+FROM games e, (SELECT id FROM games WHERE title = 'Sekiro: Shadows Die Twice' ORDER BY id LIMIT 1) b
+WHERE e.title = 'Sekiro: Shadows Die Twice - Game of the Year Edition'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS preorders;
+ALTER TABLE games DROP COLUMN IF EXISTS status;
@@ -0,0 +1,16 @@
+-- Games can be listed before they come out. Pre-order games can be bought
+-- ahead of the release date; they reach the library once it has passed.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'released';
+
+CREATE TABLE IF NOT EXISTS preorders (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    game_id bigint NOT NULL REFERENCES games ON DELETE CASCADE,
+    price double precision NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    closed_at timestamp(0) with time zone
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS preorders_pending_idx ON preorders (user_id, game_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS preorders_game_id_idx ON preorders (game_id) WHERE status = 'pending';
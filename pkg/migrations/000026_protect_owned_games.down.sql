@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS games_status_idx;
+
+ALTER TABLE preorders DROP CONSTRAINT IF EXISTS preorders_game_id_fkey;
+ALTER TABLE preorders ADD CONSTRAINT preorders_game_id_fkey FOREIGN KEY (game_id) REFERENCES games ON DELETE CASCADE;
+
+ALTER TABLE library DROP CONSTRAINT IF EXISTS library_game_id_fkey;
+ALTER TABLE library ADD CONSTRAINT library_game_id_fkey FOREIGN KEY (game_id) REFERENCES games ON DELETE CASCADE;
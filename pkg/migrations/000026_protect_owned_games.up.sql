@@ -0,0 +1,9 @@
+-- Games are delisted rather than deleted. Purging a game must not take it
+-- from its owners' libraries or pre-orders.
+ALTER TABLE library DROP CONSTRAINT IF EXISTS library_game_id_fkey;
+ALTER TABLE library ADD CONSTRAINT library_game_id_fkey FOREIGN KEY (game_id) REFERENCES games ON DELETE RESTRICT;
+
+ALTER TABLE preorders DROP CONSTRAINT IF EXISTS preorders_game_id_fkey;
+ALTER TABLE preorders ADD CONSTRAINT preorders_game_id_fkey FOREIGN KEY (game_id) REFERENCES games ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS games_status_idx ON games (status);
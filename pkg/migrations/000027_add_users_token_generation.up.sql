@@ -0,0 +1,3 @@
+-- JWTs carry the generation they were issued for. Bumping it revokes every
+-- JWT issued before.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_generation integer NOT NULL DEFAULT 1;
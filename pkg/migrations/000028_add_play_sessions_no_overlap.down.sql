@@ -0,0 +1 @@
+ALTER TABLE play_sessions DROP CONSTRAINT IF EXISTS play_sessions_no_overlap;
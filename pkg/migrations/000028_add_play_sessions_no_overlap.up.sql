@@ -0,0 +1,18 @@
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- Drop sessions that overlap an earlier report of the same game, and recount
+-- the playtime they were added to.
+WITH removed AS (
+    DELETE FROM play_sessions s
+    USING play_sessions e
+    WHERE e.user_id = s.user_id AND e.game_id = s.game_id AND e.id < s.id
+    AND tstzrange(e.started_at, e.ended_at) && tstzrange(s.started_at, s.ended_at)
+    RETURNING s.user_id, s.game_id
+)
+UPDATE library l
+SET playtime_seconds = COALESCE((SELECT sum(duration_seconds) FROM play_sessions p WHERE p.user_id = l.user_id AND p.game_id = l.game_id), 0),
+    last_played_at = (SELECT max(ended_at) FROM play_sessions p WHERE p.user_id = l.user_id AND p.game_id = l.game_id)
+WHERE (l.user_id, l.game_id) IN (SELECT user_id, game_id FROM removed);
+
+ALTER TABLE play_sessions ADD CONSTRAINT play_sessions_no_overlap
+    EXCLUDE USING gist (user_id WITH =, game_id WITH =, tstzrange(started_at, ended_at) WITH &&);
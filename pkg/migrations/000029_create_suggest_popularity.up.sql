@@ -0,0 +1,21 @@
+-- Popularity used to rank search suggestions, refreshed by a background job
+-- so suggestions don't count owners on every keystroke. Games and publishers
+-- are ranked by owners, genres by games. The containment test lets the genre
+-- count use games_genres_idx.
+CREATE MATERIALIZED VIEW IF NOT EXISTS suggest_popularity AS
+    SELECT 'game' AS kind, l.game_id::text AS key, count(*) AS popularity
+    FROM library l
+    GROUP BY l.game_id
+    UNION ALL
+    SELECT 'publisher', g.publisher_id::text, count(*)
+    FROM library l
+    INNER JOIN games g ON g.id = l.game_id
+    GROUP BY g.publisher_id
+    UNION ALL
+    SELECT 'genre', gn.slug, count(*)
+    FROM genres gn
+    INNER JOIN games g ON g.genres @> ARRAY[gn.slug] AND g.status <> 'delisted'
+    GROUP BY gn.slug;
+
+-- Needed to refresh the view concurrently.
+CREATE UNIQUE INDEX IF NOT EXISTS suggest_popularity_key_idx ON suggest_popularity (kind, key);
@@ -0,0 +1 @@
+ALTER TABLE games ALTER COLUMN sku DROP NOT NULL;
@@ -0,0 +1,5 @@
+-- Imports match games by sku, so every game gets one. New games without a
+-- sku get the same generated one when they are created.
+UPDATE games SET sku = 'game-' || id WHERE sku IS NULL OR sku = '';
+
+ALTER TABLE games ALTER COLUMN sku SET NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE library DROP CONSTRAINT IF EXISTS library_user_id_game_id_key;
@@ -0,0 +1,19 @@
+-- Concurrent purchases could add a game to a library twice. Every duplicate
+-- saw the same play sessions, so the earliest entry keeps the totals.
+WITH merged AS (
+    SELECT min(id) AS id, user_id, game_id, max(playtime_seconds) AS playtime_seconds,
+        max(last_played_at) AS last_played_at, bool_or(favorite) AS favorite, bool_and(hidden) AS hidden
+    FROM library
+    GROUP BY user_id, game_id
+    HAVING count(*) > 1
+)
+UPDATE library l
+SET playtime_seconds = m.playtime_seconds, last_played_at = m.last_played_at, favorite = m.favorite, hidden = m.hidden
+FROM merged m
+WHERE l.id = m.id;
+
+DELETE FROM library l
+USING library k
+WHERE k.user_id = l.user_id AND k.game_id = l.game_id AND k.id < l.id;
+
+ALTER TABLE library ADD CONSTRAINT library_user_id_game_id_key UNIQUE (user_id, game_id);
@@ -0,0 +1,25 @@
+-- Delisting a game remembers its status so restoring it can put a pre-order
+-- game back on pre-order. Pending pre-orders of delisted games can never be
+-- fulfilled, so they are cancelled and refunded.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS status_before_delist text;
+
+UPDATE games g
+SET status_before_delist = 'pre-order'
+WHERE g.status = 'delisted'
+    AND EXISTS (SELECT 1 FROM preorders p WHERE p.game_id = g.id AND p.status = 'pending');
+
+WITH cancelled AS (
+    UPDATE preorders p
+    SET status = 'cancelled', closed_at = NOW()
+    FROM games g
+    WHERE g.id = p.game_id AND g.status = 'delisted' AND p.status = 'pending'
+    RETURNING p.user_id, p.price
+)
+UPDATE wallet w
+SET balance = w.balance + r.refund
+FROM (
+    SELECT user_id, sum(price) AS refund
+    FROM cancelled
+    GROUP BY user_id
+) r
+WHERE w.id = r.user_id;
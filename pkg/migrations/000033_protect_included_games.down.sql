@@ -0,0 +1,5 @@
+ALTER TABLE bundle_games DROP CONSTRAINT IF EXISTS bundle_games_game_id_fkey;
+ALTER TABLE bundle_games ADD CONSTRAINT bundle_games_game_id_fkey FOREIGN KEY (game_id) REFERENCES games ON DELETE CASCADE;
+
+ALTER TABLE game_includes DROP CONSTRAINT IF EXISTS game_includes_included_id_fkey;
+ALTER TABLE game_includes ADD CONSTRAINT game_includes_included_id_fkey FOREIGN KEY (included_id) REFERENCES games ON DELETE CASCADE;
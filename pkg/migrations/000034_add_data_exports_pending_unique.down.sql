@@ -0,0 +1 @@
+DROP INDEX IF EXISTS data_exports_pending_idx;
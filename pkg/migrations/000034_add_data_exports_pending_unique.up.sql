@@ -0,0 +1,10 @@
+-- A user can only have one export being prepared at a time.
+UPDATE data_exports d
+SET status = 'failed', error = 'the export could not be assembled, please try again'
+WHERE d.status = 'pending'
+    AND EXISTS (
+        SELECT 1 FROM data_exports o
+        WHERE o.user_id = d.user_id AND o.status = 'pending' AND o.id > d.id
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS data_exports_pending_idx ON data_exports (user_id) WHERE status = 'pending';
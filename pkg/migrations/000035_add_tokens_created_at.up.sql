@@ -0,0 +1,7 @@
+-- When a token was issued tells whether its session is a fresh login.
+-- Existing authentication tokens live for a day, so they are dated back
+-- from their expiry.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone;
+UPDATE tokens SET created_at = expirt - interval '1 day' WHERE created_at IS NULL;
+ALTER TABLE tokens ALTER COLUMN created_at SET DEFAULT NOW();
+ALTER TABLE tokens ALTER COLUMN created_at SET NOT NULL;
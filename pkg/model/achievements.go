@@ -0,0 +1,260 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+var ErrDuplicateAchievement = errors.New("duplicate achievement")
+
+type Achievement struct {
+	Id          int64     `json:"id"`
+	GameID      int64     `json:"gameId"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	IconURL     string    `json:"iconUrl,omitempty"`
+	Hidden      bool      `json:"hidden"`
+	Points      int       `json:"points"`
+	CreatedAt   time.Time `json:"-"`
+	// Share of the game's owners that have unlocked the achievement.
+	UnlockPercentage float64    `json:"unlockPercentage"`
+	UnlockedAt       *time.Time `json:"unlockedAt,omitempty"`
+}
+
+// Conceal blanks out a hidden achievement the user hasn't unlocked yet.
+func (a *Achievement) Conceal() {
+	if a.Hidden && a.UnlockedAt == nil {
+		a.Name = "Hidden achievement"
+		a.Description = ""
+		a.IconURL = ""
+	}
+}
+
+// AchievementProgress sums up what a user has unlocked in one game.
+type AchievementProgress struct {
+	Unlocked    int     `json:"unlocked"`
+	Total       int     `json:"total"`
+	Points      int     `json:"points"`
+	TotalPoints int     `json:"totalPoints"`
+	Percentage  float64 `json:"percentage"`
+}
+
+func NewAchievementProgress(achievements []*Achievement) AchievementProgress {
+	var progress AchievementProgress
+
+	for _, achievement := range achievements {
+		progress.Total++
+		progress.TotalPoints += achievement.Points
+
+		if achievement.UnlockedAt != nil {
+			progress.Unlocked++
+			progress.Points += achievement.Points
+		}
+	}
+
+	if progress.Total > 0 {
+		progress.Percentage = 100 * float64(progress.Unlocked) / float64(progress.Total)
+	}
+
+	return progress
+}
+
+func ValidateAchievement(v *validator.Validator, achievement *Achievement) {
+	v.Check(achievement.Name != "", "name", "must be provided")
+	v.Check(len(achievement.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(achievement.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+	v.Check(achievement.IconURL == "" || validator.IsURL(achievement.IconURL), "iconUrl", "must be a valid http or https URL")
+	v.Check(achievement.Points >= 0, "points", "must be at least zero")
+	v.Check(achievement.Points <= 1000, "points", "must not be more than 1000")
+}
+
+type AchievementModel struct {
+	DB *sql.DB
+}
+
+func (m AchievementModel) Insert(achievement *Achievement) error {
+	query := `
+		INSERT INTO achievements (game_id, name, description, icon_url, hidden, points)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	args := []interface{}{
+		achievement.GameID,
+		achievement.Name,
+		achievement.Description,
+		achievement.IconURL,
+		achievement.Hidden,
+		achievement.Points,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&achievement.Id, &achievement.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "achievements_game_id_name_key"`:
+			return ErrDuplicateAchievement
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAllForGame returns the game's achievements with their global unlock
+// percentages and, for each, when the given user unlocked it. Unlocks by
+// users who no longer own the game are not counted.
+func (m AchievementModel) GetAllForGame(gameID, userID int64) ([]*Achievement, error) {
+	query := `
+		SELECT a.id, a.game_id, a.name, a.description, a.icon_url, a.hidden, a.points, a.created_at,
+			COALESCE(100.0 * (
+				SELECT count(*)
+				FROM user_achievements u
+				INNER JOIN library l ON l.user_id = u.user_id AND l.game_id = a.game_id
+				WHERE u.achievement_id = a.id
+			) / NULLIF((SELECT count(*) FROM library l WHERE l.game_id = a.game_id), 0), 0),
+			ua.unlocked_at
+		FROM achievements a
+		LEFT JOIN user_achievements ua ON ua.achievement_id = a.id AND ua.user_id = $2
+		WHERE a.game_id = $1
+		ORDER BY a.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, gameID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	achievements := []*Achievement{}
+
+	for rows.Next() {
+		var achievement Achievement
+		err := rows.Scan(
+			&achievement.Id,
+			&achievement.GameID,
+			&achievement.Name,
+			&achievement.Description,
+			&achievement.IconURL,
+			&achievement.Hidden,
+			&achievement.Points,
+			&achievement.CreatedAt,
+			&achievement.UnlockPercentage,
+			&achievement.UnlockedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		achievements = append(achievements, &achievement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return achievements, nil
+}
+
+// GetUnlockedForUser returns every achievement the user has unlocked, in
+// the order they were unlocked.
+func (m AchievementModel) GetUnlockedForUser(userID int64) ([]*Achievement, error) {
+	query := `
+		SELECT a.id, a.game_id, a.name, a.description, a.icon_url, a.hidden, a.points, a.created_at, ua.unlocked_at
+		FROM user_achievements ua
+		INNER JOIN achievements a ON a.id = ua.achievement_id
+		WHERE ua.user_id = $1
+		ORDER BY ua.unlocked_at, a.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	achievements := []*Achievement{}
+
+	for rows.Next() {
+		var achievement Achievement
+		err := rows.Scan(
+			&achievement.Id,
+			&achievement.GameID,
+			&achievement.Name,
+			&achievement.Description,
+			&achievement.IconURL,
+			&achievement.Hidden,
+			&achievement.Points,
+			&achievement.CreatedAt,
+			&achievement.UnlockedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		achievements = append(achievements, &achievement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return achievements, nil
+}
+
+// Unlock unlocks the achievement for the user and returns when it was
+// unlocked. Unlocking an achievement again is not an error; created is
+// false then. It returns ErrRecordNotFound unless the achievement belongs to
+// the game and the user can play it, either from their library or on lease
+// from a family member.
+func (m AchievementModel) Unlock(userID, gameID, achievementID int64) (unlockedAt time.Time, created bool, err error) {
+	query := `
+		INSERT INTO user_achievements (user_id, achievement_id)
+		SELECT $1, a.id
+		FROM achievements a
+		WHERE a.id = $3 AND a.game_id = $2 AND ` + playable + `
+		ON CONFLICT DO NOTHING
+		RETURNING unlocked_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, userID, gameID, achievementID).Scan(&unlockedAt)
+	if err == nil {
+		return unlockedAt, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, err
+	}
+
+	// Either it was unlocked before or the user can't unlock it.
+	query = `
+		SELECT ua.unlocked_at
+		FROM user_achievements ua
+		INNER JOIN achievements a ON a.id = ua.achievement_id
+		WHERE ua.user_id = $1 AND a.game_id = $2 AND a.id = $3 AND ` + playable
+
+	err = m.DB.QueryRowContext(ctx, query, userID, gameID, achievementID).Scan(&unlockedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, false, ErrRecordNotFound
+		default:
+			return time.Time{}, false, err
+		}
+	}
+
+	return unlockedAt, false, nil
+}
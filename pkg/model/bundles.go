@@ -0,0 +1,241 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/validator"
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateInclude = errors.New("duplicate include")
+
+type BundleGame struct {
+	Id         int64   `json:"id"`
+	Title      string  `json:"title"`
+	Kind       string  `json:"kind"`
+	BaseGameId *int64  `json:"baseGameId,omitempty"`
+	Price      float64 `json:"price"`
+	Status     string  `json:"status"`
+}
+
+// Bundle is a set of games sold together at a discount. Price is what the
+// whole bundle costs; buyers who already own some of the games only pay
+// for the rest.
+type Bundle struct {
+	Id              int64        `json:"id"`
+	Name            string       `json:"name"`
+	DiscountPercent int          `json:"discountPercent"`
+	GameIds         []int64      `json:"-"`
+	Games           []BundleGame `json:"games"`
+	Price           float64      `json:"price"`
+	CreatedAt       time.Time    `json:"createdAt"`
+}
+
+// BundlePrice applies a bundle discount to the full price of its games,
+// rounded to cents.
+func BundlePrice(total float64, discountPercent int) float64 {
+	return math.Round(total*float64(100-discountPercent)) / 100
+}
+
+func ValidateBundle(v *validator.Validator, bundle *Bundle) {
+	v.Check(bundle.Name != "", "name", "must be provided")
+	v.Check(len(bundle.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(bundle.DiscountPercent >= 0 && bundle.DiscountPercent <= 100, "discountPercent", "must be between 0 and 100")
+	v.Check(len(bundle.GameIds) >= 2, "games", "must contain at least two games")
+	v.Check(len(bundle.GameIds) <= 100, "games", "must not contain more than 100 games")
+
+	seen := make(map[int64]bool)
+	for _, id := range bundle.GameIds {
+		v.Check(!seen[id], "games", "must not contain duplicate values")
+		seen[id] = true
+	}
+}
+
+type BundleModel struct {
+	DB *sql.DB
+}
+
+func (m BundleModel) Insert(bundle *Bundle) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO bundles (name, discount_percent)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`
+
+	err = tx.QueryRowContext(ctx, query, bundle.Name, bundle.DiscountPercent).Scan(&bundle.Id, &bundle.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO bundle_games (bundle_id, game_id)
+		SELECT $1, unnest($2::bigint[])
+	`
+
+	_, err = tx.ExecContext(ctx, query, bundle.Id, pq.Array(bundle.GameIds))
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "bundle_games" violates foreign key constraint "bundle_games_game_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m BundleModel) Get(id int64) (*Bundle, error) {
+	bundles, err := m.get(`WHERE b.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bundles) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return bundles[0], nil
+}
+
+func (m BundleModel) GetAll() ([]*Bundle, error) {
+	return m.get(``)
+}
+
+func (m BundleModel) get(where string, args ...interface{}) ([]*Bundle, error) {
+	query := `
+		SELECT b.id, b.name, b.discount_percent, b.created_at, g.id, g.title, g.kind, g.base_game_id, g.price, g.status
+		FROM bundles b
+		INNER JOIN bundle_games bg ON bg.bundle_id = b.id
+		INNER JOIN games g ON g.id = bg.game_id
+		` + where + `
+		ORDER BY b.id, g.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bundles := []*Bundle{}
+	var bundle *Bundle
+	var total float64
+
+	for rows.Next() {
+		var b Bundle
+		var game BundleGame
+
+		err := rows.Scan(&b.Id, &b.Name, &b.DiscountPercent, &b.CreatedAt, &game.Id, &game.Title, &game.Kind, &game.BaseGameId, &game.Price, &game.Status)
+		if err != nil {
+			return nil, err
+		}
+
+		if bundle == nil || bundle.Id != b.Id {
+			bundle, total = &b, 0
+			bundles = append(bundles, bundle)
+		}
+
+		bundle.Games = append(bundle.Games, game)
+		bundle.GameIds = append(bundle.GameIds, game.Id)
+		total += game.Price
+		bundle.Price = BundlePrice(total, bundle.DiscountPercent)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bundles, nil
+}
+
+func (m BundleModel) Delete(id int64) error {
+	query := `
+		DELETE FROM bundles
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AddInclude adds a game or DLC to an edition.
+func (m GameModel) AddInclude(id, includedID int64) error {
+	query := `
+		INSERT INTO game_includes (game_id, included_id)
+		VALUES ($1, $2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id, includedID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "game_includes_pkey"`:
+			return ErrDuplicateInclude
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m GameModel) RemoveInclude(id, includedID int64) error {
+	query := `
+		DELETE FROM game_includes
+		WHERE game_id = $1 AND included_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, includedID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package model
+
+import "testing"
+
+func TestBundlePrice(t *testing.T) {
+	tests := []struct {
+		total    float64
+		discount int
+		want     float64
+	}{
+		{100, 0, 100},
+		{100, 100, 0},
+		{79.98, 10, 71.98},
+		{19.99, 15, 16.99},
+		{59.99 + 19.99 + 9.99, 25, 67.48},
+		{0.01, 50, 0.01},
+		{0, 30, 0},
+	}
+
+	for _, tt := range tests {
+		if got := BundlePrice(tt.total, tt.discount); got != tt.want {
+			t.Errorf("BundlePrice(%v, %d) = %v, want %v", tt.total, tt.discount, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GetBySKUs returns the games with the given skus, keyed by sku. Only the
+// id, sku, kind, status and included games are loaded, which is what an import
+// needs to check its rows against.
+func (m GameModel) GetBySKUs(skus []string) (map[string]*Game, error) {
+	query := `
+		SELECT id, sku, kind, status, ARRAY(SELECT gi.included_id FROM game_includes gi WHERE gi.game_id = games.id ORDER BY gi.included_id)
+		FROM games
+		WHERE sku = ANY($1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(skus))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	games := make(map[string]*Game)
+
+	for rows.Next() {
+		var game Game
+		if err := rows.Scan(&game.Id, &game.SKU, &game.Kind, &game.Status, pq.Array(&game.Includes)); err != nil {
+			return nil, err
+		}
+		games[game.SKU] = &game
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return games, nil
+}
+
+// Import creates or updates games by sku, all in one transaction. It returns
+// ErrRecordNotFound if the base game of a DLC doesn't exist.
+func (m GameModel) Import(games []*Game) (created, updated int, err error) {
+	query := `
+		INSERT INTO games (title, genres, price, release_date, publisher_id, short_description, description,
+			developer, platforms, languages, age_rating, min_age, system_requirements, screenshots, trailers, sku,
+			kind, base_game_id, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9::text[], '{}'), COALESCE($10::text[], '{}'), $11, $12, $13,
+			COALESCE($14::text[], '{}'), COALESCE($15::text[], '{}'), $16, $17, $18, $19)
+		ON CONFLICT (sku) DO UPDATE
+		SET title = EXCLUDED.title, genres = EXCLUDED.genres, price = EXCLUDED.price,
+			release_date = EXCLUDED.release_date, publisher_id = EXCLUDED.publisher_id,
+			short_description = EXCLUDED.short_description, description = EXCLUDED.description,
+			developer = EXCLUDED.developer, platforms = EXCLUDED.platforms, languages = EXCLUDED.languages,
+			age_rating = EXCLUDED.age_rating, min_age = EXCLUDED.min_age,
+			system_requirements = EXCLUDED.system_requirements, screenshots = EXCLUDED.screenshots,
+			trailers = EXCLUDED.trailers, kind = EXCLUDED.kind, base_game_id = EXCLUDED.base_game_id,
+			status = EXCLUDED.status,
+			version = games.version + 1
+		RETURNING id, created_at, version, xmax = 0
+	`
+
+	// Large catalogs take a while.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer stmt.Close()
+
+	for _, game := range games {
+		args := []interface{}{
+			game.Title,
+			pq.Array(game.Genres),
+			game.Price,
+			game.ReleaseDate,
+			game.PublisherId,
+			game.ShortDescription,
+			game.Description,
+			game.Developer,
+			pq.Array(game.Platforms),
+			pq.Array(game.Languages),
+			game.AgeRating,
+			game.minAge(),
+			game.SystemRequirements,
+			pq.Array(game.Screenshots),
+			pq.Array(game.Trailers),
+			game.SKU,
+			game.Kind,
+			game.BaseGameId,
+			game.Status,
+		}
+
+		var inserted bool
+
+		err = stmt.QueryRowContext(ctx, args...).Scan(&game.Id, &game.CreatedAt, &game.Version, &inserted)
+		if err != nil {
+			switch {
+			// The base game was purged after the rows were validated.
+			case err.Error() == `pq: insert or update on table "games" violates foreign key constraint "games_base_game_id_fkey"`:
+				return 0, 0, ErrRecordNotFound
+			default:
+				return 0, 0, err
+			}
+		}
+
+		if inserted {
+			created++
+		} else {
+			updated++
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+
+	return created, updated, nil
+}
+
+// Export calls fn with every game, ordered by id, without loading the whole
+// catalog into memory. It stops at the first error fn returns.
+func (m GameModel) Export(fn func(*Game) error) error {
+	query := `
+		SELECT ` + gameColumns + `
+		FROM games g
+		ORDER BY g.id
+	`
+
+	// Bounded by the server's write timeout in practice.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var game Game
+		if err := rows.Scan(game.scanDest()...); err != nil {
+			return err
+		}
+
+		if err := fn(&game); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,259 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+var ErrDuplicateCollection = errors.New("duplicate collection")
+
+type Collection struct {
+	Id        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Name      string    `json:"name"`
+	GameCount int       `json:"gameCount"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+func (m CollectionModel) Insert(collection *Collection) error {
+	query := `
+		INSERT INTO collections (user_id, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, collection.UserID, collection.Name).Scan(&collection.Id, &collection.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "collections_user_id_name_key"`:
+			return ErrDuplicateCollection
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Only games still in the user's library count towards a collection.
+const collectionColumns = `
+	c.id, c.user_id, c.name, c.created_at, (
+		SELECT count(*)
+		FROM collection_games cg
+		INNER JOIN library l ON l.game_id = cg.game_id AND l.user_id = c.user_id
+		WHERE cg.collection_id = c.id
+	)
+`
+
+func (m CollectionModel) Get(id, userID int64) (*Collection, error) {
+	query := `
+		SELECT ` + collectionColumns + `
+		FROM collections c
+		WHERE c.id = $1 AND c.user_id = $2
+	`
+
+	var collection Collection
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&collection.Id,
+		&collection.UserID,
+		&collection.Name,
+		&collection.CreatedAt,
+		&collection.GameCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &collection, nil
+}
+
+func (m CollectionModel) GetAllForUser(userID int64) ([]*Collection, error) {
+	query := `
+		SELECT ` + collectionColumns + `
+		FROM collections c
+		WHERE c.user_id = $1
+		ORDER BY c.name, c.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+
+	for rows.Next() {
+		var collection Collection
+		err := rows.Scan(
+			&collection.Id,
+			&collection.UserID,
+			&collection.Name,
+			&collection.CreatedAt,
+			&collection.GameCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, &collection)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+func (m CollectionModel) Update(collection *Collection) error {
+	query := `
+		UPDATE collections
+		SET name = $1
+		WHERE id = $2 AND user_id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, collection.Name, collection.Id, collection.UserID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "collections_user_id_name_key"`:
+			return ErrDuplicateCollection
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m CollectionModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM collections
+		WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AddGame adds a game from the user's library to one of their collections.
+// Adding a game twice is not an error. It returns ErrRecordNotFound if the
+// collection isn't the user's or the game isn't in their library.
+func (m CollectionModel) AddGame(id, userID, gameID int64) error {
+	query := `
+		INSERT INTO collection_games (collection_id, game_id)
+		SELECT c.id, l.game_id
+		FROM collections c
+		INNER JOIN library l ON l.user_id = c.user_id AND l.game_id = $3
+		WHERE c.id = $1 AND c.user_id = $2
+		LIMIT 1
+		ON CONFLICT DO NOTHING
+		RETURNING collection_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var collectionID int64
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID, gameID).Scan(&collectionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Nothing was inserted, check whether it's already there.
+		query = `
+			SELECT cg.collection_id
+			FROM collection_games cg
+			INNER JOIN collections c ON c.id = cg.collection_id
+			INNER JOIN library l ON l.user_id = c.user_id AND l.game_id = cg.game_id
+			WHERE cg.collection_id = $1 AND c.user_id = $2 AND cg.game_id = $3
+			LIMIT 1
+		`
+		err = m.DB.QueryRowContext(ctx, query, id, userID, gameID).Scan(&collectionID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+	}
+
+	return err
+}
+
+func (m CollectionModel) RemoveGame(id, userID, gameID int64) error {
+	query := `
+		DELETE FROM collection_games cg
+		USING collections c
+		WHERE c.id = cg.collection_id AND cg.collection_id = $1 AND c.user_id = $2 AND cg.game_id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID, gameID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
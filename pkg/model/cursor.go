@@ -0,0 +1,72 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var cursorEncoding = base64.RawURLEncoding
+
+// Cursor marks a position in a sorted listing: the sort key and id of the
+// row next to it. Before is set for cursors pointing to the previous page,
+// and Filter holds the FilterHash of the listing the cursor belongs to.
+// Clients get cursors signed and opaque, so they can't craft their own.
+type Cursor struct {
+	Sort   string `json:"s"`
+	Filter string `json:"f,omitempty"`
+	Value  string `json:"v"`
+	Id     int64  `json:"i"`
+	Before bool   `json:"b,omitempty"`
+}
+
+// FilterHash sums up the filters of a listing, such as a GameSearch, so a
+// cursor can't be replayed against a listing filtered differently.
+func FilterHash(filters interface{}) string {
+	payload, _ := json.Marshal(filters)
+
+	sum := sha256.Sum256(payload)
+	return cursorEncoding.EncodeToString(sum[:12])
+}
+
+func (c Cursor) Encode(key []byte) string {
+	payload, _ := json.Marshal(c)
+
+	encoded := cursorEncoding.EncodeToString(payload)
+	return encoded + "." + cursorEncoding.EncodeToString(signCursor(encoded, key))
+}
+
+func DecodeCursor(s string, key []byte) (*Cursor, error) {
+	encoded, signature, found := strings.Cut(s, ".")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+
+	sig, err := cursorEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, signCursor(encoded, key)) {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := cursorEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+func signCursor(encoded string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	key := []byte("cursor-key")
+
+	tests := []Cursor{
+		{Sort: "title", Value: "Portal", Id: 7},
+		{Sort: "-price", Value: "9.99", Id: 12, Before: true},
+		{Sort: "title", Filter: FilterHash(GameSearch{Genres: []string{"rpg"}}), Value: "Portal", Id: 7},
+		{Sort: "id", Value: "", Id: 1},
+		{Sort: "title", Value: "Ünïcode, \"quotes\" & dots...", Id: 3},
+	}
+
+	for _, want := range tests {
+		encoded := want.Encode(key)
+
+		got, err := DecodeCursor(encoded, key)
+		if err != nil {
+			t.Fatalf("DecodeCursor(%q): %v", encoded, err)
+		}
+		if *got != want {
+			t.Fatalf("got %+v, want %+v", *got, want)
+		}
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	key := []byte("cursor-key")
+	valid := Cursor{Sort: "title", Value: "Portal", Id: 7}.Encode(key)
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	forged := Cursor{Sort: "title", Value: "Portal", Id: 8}.Encode([]byte("other-key"))
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "empty", cursor: ""},
+		{name: "unsigned", cursor: payload},
+		{name: "other key", cursor: forged},
+		{name: "swapped payload", cursor: forgedPayload + "." + signature},
+		{name: "bad signature encoding", cursor: payload + ".!!"},
+		{name: "not json", cursor: "bm90IGpzb24." + cursorEncoding.EncodeToString(signCursor("bm90IGpzb24", key))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeCursor(tt.cursor, key); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("err = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestFilterHash(t *testing.T) {
+	rpg := GameSearch{Genres: []string{"rpg"}, MaxPrice: 30}
+
+	if FilterHash(rpg) != FilterHash(GameSearch{Genres: []string{"rpg"}, MaxPrice: 30}) {
+		t.Fatal("equal filters hash differently")
+	}
+
+	others := []GameSearch{
+		{},
+		{Genres: []string{"strategy"}, MaxPrice: 30},
+		{Genres: []string{"rpg"}, MaxPrice: 60},
+		{Genres: []string{"rpg"}, MaxPrice: 30, Query: "dragon"},
+		{Genres: []string{"rpg"}, MaxPrice: 30, PublisherId: 4},
+	}
+
+	for _, other := range others {
+		if FilterHash(rpg) == FilterHash(other) {
+			t.Errorf("%+v hashes like %+v", other, rpg)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+var ErrExportPending = errors.New("export pending")
+
+// staleExportAge is how long an export may stay pending. Older ones were
+// lost, e.g. to a restart, and no longer keep the user from a new export.
+const staleExportAge = time.Hour
+
+type DataExport struct {
+	Id        int64      `json:"id"`
+	UserID    int64      `json:"-"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type DataExportModel struct {
+	DB *sql.DB
+}
+
+// Insert starts a new export. It returns ErrExportPending while another
+// export of the user is still being prepared.
+func (m DataExportModel) Insert(export *DataExport) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE data_exports
+		SET status = $1, error = 'the export could not be assembled, please try again'
+		WHERE user_id = $2 AND status = $3 AND created_at < $4
+	`
+
+	_, err = tx.ExecContext(ctx, query, ExportFailed, export.UserID, ExportPending, time.Now().Add(-staleExportAge))
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO data_exports (user_id)
+		VALUES ($1)
+		RETURNING id, status, created_at
+	`
+
+	err = tx.QueryRowContext(ctx, query, export.UserID).Scan(&export.Id, &export.Status, &export.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "data_exports_pending_idx"`:
+			return ErrExportPending
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m DataExportModel) Get(id, userID int64) (*DataExport, error) {
+	query := `
+		SELECT id, user_id, status, error, created_at, expires_at
+		FROM data_exports
+		WHERE id = $1 AND user_id = $2
+	`
+
+	var export DataExport
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&export.Id,
+		&export.UserID,
+		&export.Status,
+		&export.Error,
+		&export.CreatedAt,
+		&export.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if export.Status == ExportReady && export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt) {
+		export.Status = ExportExpired
+	}
+
+	return &export, nil
+}
+
+func (m DataExportModel) GetArchive(id, userID int64) ([]byte, error) {
+	query := `
+		SELECT archive
+		FROM data_exports
+		WHERE id = $1 AND user_id = $2 AND status = $3 AND expires_at > $4
+	`
+
+	var archive []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID, ExportReady, time.Now()).Scan(&archive)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return archive, nil
+}
+
+func (m DataExportModel) Complete(id int64, archive []byte, ttl time.Duration) error {
+	query := `
+		UPDATE data_exports
+		SET status = $1, archive = $2, expires_at = $3
+		WHERE id = $4
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, ExportReady, archive, time.Now().Add(ttl), id)
+	return err
+}
+
+func (m DataExportModel) Fail(id int64, reason string) error {
+	query := `
+		UPDATE data_exports
+		SET status = $1, error = $2
+		WHERE id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, ExportFailed, reason, id)
+	return err
+}
+
+// DeleteExpired drops archives whose download window has passed. The rows
+// are kept so users polling an old export see it as expired.
+func (m DataExportModel) DeleteExpired() error {
+	query := `
+		UPDATE data_exports
+		SET archive = NULL, status = $1
+		WHERE status = $2 AND expires_at <= $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, ExportExpired, ExportReady, time.Now())
+	return err
+}
@@ -0,0 +1,600 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+var (
+	ErrAlreadyInFamily = errors.New("already in a family")
+	ErrFamilyFull      = errors.New("family is full")
+	ErrDuplicateInvite = errors.New("duplicate family invite")
+	ErrGameInUse       = errors.New("game in use")
+)
+
+type Family struct {
+	Id        int64           `json:"id"`
+	OwnerID   int64           `json:"owner_id"`
+	Name      string          `json:"name"`
+	CreatedAt time.Time       `json:"created_at"`
+	Members   []*FamilyMember `json:"members"`
+	// Pending invites, only shown to the owner.
+	Invites []*FamilyInvite `json:"invites,omitempty"`
+}
+
+type FamilyMember struct {
+	PublicUser
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type FamilyInvite struct {
+	Id         int64       `json:"id"`
+	FamilyID   int64       `json:"family_id"`
+	FamilyName string      `json:"family_name"`
+	User       *PublicUser `json:"user"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// GameLease is a family member's checkout of another member's copy of a
+// game.
+type GameLease struct {
+	GameID     int64       `json:"gameId"`
+	Lender     *PublicUser `json:"lender"`
+	BorrowerID int64       `json:"-"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	ExpiresAt  time.Time   `json:"expiresAt"`
+}
+
+func ValidateFamily(v *validator.Validator, family *Family) {
+	v.Check(family.Name != "", "name", "must be provided")
+	v.Check(len(family.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+type FamilyModel struct {
+	DB *sql.DB
+}
+
+// Insert creates the family with its owner as the first member.
+func (m FamilyModel) Insert(family *Family) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var member bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM family_members WHERE user_id = $1)`, family.OwnerID).Scan(&member)
+	if err != nil {
+		return err
+	}
+	if member {
+		return ErrAlreadyInFamily
+	}
+
+	query := `
+		INSERT INTO families (owner_id, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`
+	err = tx.QueryRowContext(ctx, query, family.OwnerID, family.Name).Scan(&family.Id, &family.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO family_members (family_id, user_id) VALUES ($1, $2)`, family.Id, family.OwnerID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "family_members_user_id_key"`:
+			return ErrAlreadyInFamily
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetForUser returns the family the user belongs to, with its members and
+// pending invites.
+func (m FamilyModel) GetForUser(userID int64) (*Family, error) {
+	query := `
+		SELECT f.id, f.owner_id, f.name, f.created_at
+		FROM families f
+		INNER JOIN family_members fm ON fm.family_id = f.id
+		WHERE fm.user_id = $1
+	`
+
+	var family Family
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&family.Id, &family.OwnerID, &family.Name, &family.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		SELECT u.id, u.name, fm.joined_at
+		FROM family_members fm
+		INNER JOIN users u ON u.id = fm.user_id
+		WHERE fm.family_id = $1
+		ORDER BY fm.joined_at, u.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, family.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	family.Members = []*FamilyMember{}
+
+	for rows.Next() {
+		var member FamilyMember
+		err := rows.Scan(&member.Id, &member.Name, &member.JoinedAt)
+		if err != nil {
+			return nil, err
+		}
+		family.Members = append(family.Members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	family.Invites, err = m.getInvites(ctx, "fi.family_id = $1", family.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &family, nil
+}
+
+func (m FamilyModel) Delete(id int64) error {
+	query := `
+		DELETE FROM families
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Invite invites the user to the family. Pending invites count towards the
+// member limit, so a full family can't hand out more invites.
+func (m FamilyModel) Invite(familyID, userID int64, maxMembers int) (*FamilyInvite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	invite := FamilyInvite{FamilyID: familyID, User: &PublicUser{Id: userID}}
+
+	// Lock the family so concurrent invites can't go over the limit.
+	err = tx.QueryRowContext(ctx, `SELECT name FROM families WHERE id = $1 FOR UPDATE`, familyID).Scan(&invite.FamilyName)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	var member bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM family_members WHERE user_id = $1)`, userID).Scan(&member)
+	if err != nil {
+		return nil, err
+	}
+	if member {
+		return nil, ErrAlreadyInFamily
+	}
+
+	var size int
+	query := `
+		SELECT (SELECT count(*) FROM family_members WHERE family_id = $1)
+			+ (SELECT count(*) FROM family_invites WHERE family_id = $1)
+	`
+	err = tx.QueryRowContext(ctx, query, familyID).Scan(&size)
+	if err != nil {
+		return nil, err
+	}
+	if size >= maxMembers {
+		return nil, ErrFamilyFull
+	}
+
+	query = `
+		INSERT INTO family_invites (family_id, user_id)
+		VALUES ($1, $2)
+		RETURNING id, created_at, (SELECT name FROM users WHERE id = $2)
+	`
+	err = tx.QueryRowContext(ctx, query, familyID, userID).Scan(&invite.Id, &invite.CreatedAt, &invite.User.Name)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "family_invites_family_id_user_id_key"`:
+			return nil, ErrDuplicateInvite
+		default:
+			return nil, err
+		}
+	}
+
+	return &invite, tx.Commit()
+}
+
+// GetInvitesForUser returns the invites the user has received.
+func (m FamilyModel) GetInvitesForUser(userID int64) ([]*FamilyInvite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.getInvites(ctx, "fi.user_id = $1", userID)
+}
+
+// where is one of the constant conditions used by the callers above.
+func (m FamilyModel) getInvites(ctx context.Context, where string, arg int64) ([]*FamilyInvite, error) {
+	query := `
+		SELECT fi.id, fi.family_id, f.name, u.id, u.name, fi.created_at
+		FROM family_invites fi
+		INNER JOIN families f ON f.id = fi.family_id
+		INNER JOIN users u ON u.id = fi.user_id
+		WHERE ` + where + `
+		ORDER BY fi.created_at DESC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*FamilyInvite{}
+
+	for rows.Next() {
+		invite := FamilyInvite{User: &PublicUser{}}
+		err := rows.Scan(
+			&invite.Id,
+			&invite.FamilyID,
+			&invite.FamilyName,
+			&invite.User.Id,
+			&invite.User.Name,
+			&invite.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, &invite)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// AcceptInvite makes the user a member of the inviting family. Other
+// invites the user received are dropped.
+func (m FamilyModel) AcceptInvite(inviteID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var familyID int64
+	query := `
+		DELETE FROM family_invites
+		WHERE id = $1 AND user_id = $2
+		RETURNING family_id
+	`
+	err = tx.QueryRowContext(ctx, query, inviteID, userID).Scan(&familyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO family_members (family_id, user_id) VALUES ($1, $2)`, familyID, userID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "family_members_user_id_key"`:
+			return ErrAlreadyInFamily
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM family_invites WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m FamilyModel) DeclineInvite(inviteID, userID int64) error {
+	query := `
+		DELETE FROM family_invites
+		WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, inviteID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RemoveMember removes the user from the family and ends the leases they
+// are part of.
+func (m FamilyModel) RemoveMember(familyID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM family_members WHERE family_id = $1 AND user_id = $2`, familyID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM game_leases
+		WHERE family_id = $1 AND (lender_id = $2 OR borrower_id = $2)
+	`
+	_, err = tx.ExecContext(ctx, query, familyID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Checkout lends the user a copy of the game from another family member
+// for ttl. Calling it again while holding the lease renews it. It returns
+// ErrRecordNotFound if nobody in the family owns the game, and ErrGameInUse
+// if every copy is lent to someone else.
+//
+// Owners check out their own copy instead, which keeps it from being lent
+// out while they play. They get ErrGameInUse while a member has it, and
+// ErrRecordNotFound when they are not in a family.
+func (m FamilyModel) Checkout(userID, gameID int64, ttl time.Duration) (*GameLease, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	lease := GameLease{GameID: gameID, BorrowerID: userID, Lender: &PublicUser{}}
+	expiry := time.Now().Add(ttl)
+
+	query := `
+		UPDATE game_leases
+		SET expires_at = $3
+		WHERE borrower_id = $1 AND game_id = $2 AND expires_at > NOW()
+		RETURNING lender_id, (SELECT name FROM users WHERE id = lender_id), created_at, expires_at
+	`
+	err := m.DB.QueryRowContext(ctx, query, userID, gameID, expiry).Scan(
+		&lease.Lender.Id,
+		&lease.Lender.Name,
+		&lease.CreatedAt,
+		&lease.ExpiresAt,
+	)
+	if err == nil {
+		return &lease, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	var owns bool
+	query = `
+		SELECT EXISTS (
+			SELECT 1 FROM library WHERE user_id = $1 AND game_id = $2
+		)
+	`
+	err = m.DB.QueryRowContext(ctx, query, userID, gameID).Scan(&owns)
+	if err != nil {
+		return nil, err
+	}
+
+	if owns {
+		return m.checkoutOwnCopy(ctx, userID, gameID, expiry)
+	}
+
+	// Take the first copy that isn't lent out. An expired lease on it is
+	// replaced, a live one makes the insert a no-op.
+	query = `
+		INSERT INTO game_leases (family_id, lender_id, game_id, borrower_id, expires_at)
+		SELECT me.family_id, l.user_id, l.game_id, $1, $3
+		FROM library l
+		INNER JOIN family_members fm ON fm.user_id = l.user_id
+		INNER JOIN family_members me ON me.family_id = fm.family_id AND me.user_id = $1
+		WHERE l.game_id = $2 AND l.user_id <> $1
+		AND NOT EXISTS (
+			SELECT 1 FROM game_leases gl
+			WHERE gl.lender_id = l.user_id AND gl.game_id = l.game_id AND gl.expires_at > NOW()
+		)
+		ORDER BY l.created_at
+		LIMIT 1
+		ON CONFLICT (lender_id, game_id) DO UPDATE
+		SET family_id = EXCLUDED.family_id, borrower_id = EXCLUDED.borrower_id,
+			created_at = NOW(), expires_at = EXCLUDED.expires_at
+		WHERE game_leases.expires_at <= NOW()
+		RETURNING lender_id, (SELECT name FROM users WHERE id = lender_id), created_at, expires_at
+	`
+	err = m.DB.QueryRowContext(ctx, query, userID, gameID, expiry).Scan(
+		&lease.Lender.Id,
+		&lease.Lender.Name,
+		&lease.CreatedAt,
+		&lease.ExpiresAt,
+	)
+	if err == nil {
+		return &lease, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	var shared bool
+	query = `
+		SELECT EXISTS (
+			SELECT 1
+			FROM library l
+			INNER JOIN family_members fm ON fm.user_id = l.user_id
+			INNER JOIN family_members me ON me.family_id = fm.family_id AND me.user_id = $1
+			WHERE l.game_id = $2 AND l.user_id <> $1
+		)
+	`
+	err = m.DB.QueryRowContext(ctx, query, userID, gameID).Scan(&shared)
+	if err != nil {
+		return nil, err
+	}
+
+	if !shared {
+		return nil, ErrRecordNotFound
+	}
+
+	return nil, ErrGameInUse
+}
+
+func (m FamilyModel) checkoutOwnCopy(ctx context.Context, userID, gameID int64, expiry time.Time) (*GameLease, error) {
+	lease := GameLease{GameID: gameID, BorrowerID: userID, Lender: &PublicUser{}}
+
+	query := `
+		INSERT INTO game_leases (family_id, lender_id, game_id, borrower_id, expires_at)
+		SELECT family_id, $1, $2, $1, $3
+		FROM family_members
+		WHERE user_id = $1
+		ON CONFLICT (lender_id, game_id) DO UPDATE
+		SET family_id = EXCLUDED.family_id, borrower_id = EXCLUDED.borrower_id,
+			created_at = NOW(), expires_at = EXCLUDED.expires_at
+		WHERE game_leases.expires_at <= NOW()
+		RETURNING lender_id, (SELECT name FROM users WHERE id = lender_id), created_at, expires_at
+	`
+	err := m.DB.QueryRowContext(ctx, query, userID, gameID, expiry).Scan(
+		&lease.Lender.Id,
+		&lease.Lender.Name,
+		&lease.CreatedAt,
+		&lease.ExpiresAt,
+	)
+	if err == nil {
+		return &lease, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	var lent bool
+	query = `
+		SELECT EXISTS (
+			SELECT 1 FROM game_leases WHERE lender_id = $1 AND game_id = $2 AND expires_at > NOW()
+		)
+	`
+	err = m.DB.QueryRowContext(ctx, query, userID, gameID).Scan(&lent)
+	if err != nil {
+		return nil, err
+	}
+
+	if lent {
+		return nil, ErrGameInUse
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// Return ends the user's lease of the game.
+func (m FamilyModel) Return(userID, gameID int64) error {
+	query := `
+		DELETE FROM game_leases
+		WHERE borrower_id = $1 AND game_id = $2 AND expires_at > NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, gameID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m FamilyModel) DeleteExpiredLeases() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM game_leases WHERE expires_at <= NOW()`)
+	return err
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"math"
 	"strings"
 
@@ -8,11 +9,17 @@ import (
 ) 
 
 
+// Filters paginate a listing by page, or by Cursor when it's set. CursorKey
+// signs the cursors returned in Metadata, and Filter, the FilterHash of the
+// listing, goes into them.
 type Filters struct {
 	Page int 
 	PageSize int 
 	Sort string 
 	SortSafelist []string 
+	Cursor *Cursor
+	CursorKey []byte
+	Filter string
 }
 
 type Metadata struct {
@@ -21,6 +28,8 @@ type Metadata struct {
 	FirstPage int `json:"first_page,omitempty"`
 	LastPage int `json:"last_page,omitempty"`
 	TotalRecords int `json:"total_records,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -63,6 +72,60 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// keyset returns the condition and order of a page after or before the
+// cursor, for a listing sorted by expr with id as the tie-breaker. valueParam
+// and idParam are the placeholders of the cursor's value and id.
+func (f Filters) keyset(expr, id, valueParam, idParam string) (where, orderBy string) {
+	direction := f.sortDirection()
+	if f.Cursor != nil && f.Cursor.Before {
+		// Walk backwards from the cursor, the rows are put back in order
+		// afterwards.
+		direction = map[string]string{"ASC": "DESC", "DESC": "ASC"}[direction]
+	}
+
+	orderBy = fmt.Sprintf("%s %s, %s %s", expr, direction, id, direction)
+
+	if f.Cursor == nil {
+		return "", orderBy
+	}
+
+	comparison := ">"
+	if direction == "DESC" {
+		comparison = "<"
+	}
+
+	where = fmt.Sprintf("AND (%s, %s) %s (%s, %s)", expr, id, comparison, valueParam, idParam)
+	return where, orderBy
+}
+
+// cursors fills in the cursors of a page whose sort keys and ids are given
+// in order. more tells whether a row past the page was found in the
+// direction it was fetched.
+func (f Filters) cursors(metadata *Metadata, keys []string, ids []int64, more bool) {
+	if len(ids) == 0 {
+		return
+	}
+
+	// A page reached from a cursor always has the cursor's side to go back
+	// to.
+	hasNext, hasPrev := more, f.Page > 1
+	switch {
+	case f.Cursor != nil && f.Cursor.Before:
+		hasNext, hasPrev = true, more
+	case f.Cursor != nil:
+		hasNext, hasPrev = more, true
+	}
+
+	last := len(ids) - 1
+
+	if hasNext {
+		metadata.NextCursor = Cursor{Sort: f.Sort, Filter: f.Filter, Value: keys[last], Id: ids[last]}.Encode(f.CursorKey)
+	}
+	if hasPrev {
+		metadata.PrevCursor = Cursor{Sort: f.Sort, Filter: f.Filter, Value: keys[0], Id: ids[0], Before: true}.Encode(f.CursorKey)
+	}
+}
+
 func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page > 0, "page", "must be greater than zero")
 	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
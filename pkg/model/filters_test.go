@@ -0,0 +1,150 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+func TestKeyset(t *testing.T) {
+	after := &Cursor{Sort: "title", Value: "Portal", Id: 7}
+	before := &Cursor{Sort: "title", Value: "Portal", Id: 7, Before: true}
+
+	tests := []struct {
+		name        string
+		sort        string
+		cursor      *Cursor
+		wantWhere   string
+		wantOrderBy string
+	}{
+		{name: "first page", sort: "title", wantOrderBy: "g.title ASC, g.id ASC"},
+		{name: "first page descending", sort: "-title", wantOrderBy: "g.title DESC, g.id DESC"},
+		{name: "after", sort: "title", cursor: after, wantWhere: "AND (g.title, g.id) > ($1, $2)", wantOrderBy: "g.title ASC, g.id ASC"},
+		{name: "after descending", sort: "-title", cursor: after, wantWhere: "AND (g.title, g.id) < ($1, $2)", wantOrderBy: "g.title DESC, g.id DESC"},
+		{name: "before", sort: "title", cursor: before, wantWhere: "AND (g.title, g.id) < ($1, $2)", wantOrderBy: "g.title DESC, g.id DESC"},
+		{name: "before descending", sort: "-title", cursor: before, wantWhere: "AND (g.title, g.id) > ($1, $2)", wantOrderBy: "g.title ASC, g.id ASC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{Sort: tt.sort, Cursor: tt.cursor}
+
+			where, orderBy := f.keyset("g.title", "g.id", "$1", "$2")
+			if where != tt.wantWhere {
+				t.Errorf("where = %q, want %q", where, tt.wantWhere)
+			}
+			if orderBy != tt.wantOrderBy {
+				t.Errorf("orderBy = %q, want %q", orderBy, tt.wantOrderBy)
+			}
+		})
+	}
+}
+
+func TestCursors(t *testing.T) {
+	key := []byte("cursor-key")
+	keys := []string{"A", "B", "C"}
+	ids := []int64{1, 2, 3}
+
+	next := &Cursor{Sort: "title", Filter: "genre=rpg", Value: "C", Id: 3}
+	prev := &Cursor{Sort: "title", Filter: "genre=rpg", Value: "A", Id: 1, Before: true}
+
+	tests := []struct {
+		name     string
+		page     int
+		cursor   *Cursor
+		ids      []int64
+		more     bool
+		wantNext *Cursor
+		wantPrev *Cursor
+	}{
+		{name: "empty page", page: 1, more: true},
+		{name: "only page", page: 1, ids: ids},
+		{name: "first page", page: 1, ids: ids, more: true, wantNext: next},
+		{name: "last numbered page", page: 2, ids: ids, wantPrev: prev},
+		{name: "after cursor", page: 1, cursor: &Cursor{Id: 9}, ids: ids, more: true, wantNext: next, wantPrev: prev},
+		{name: "after cursor, last page", page: 1, cursor: &Cursor{Id: 9}, ids: ids, wantPrev: prev},
+		{name: "before cursor", page: 1, cursor: &Cursor{Id: 9, Before: true}, ids: ids, more: true, wantNext: next, wantPrev: prev},
+		{name: "before cursor, first page", page: 1, cursor: &Cursor{Id: 9, Before: true}, ids: ids, wantNext: next},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{Page: tt.page, Sort: "title", Cursor: tt.cursor, CursorKey: key, Filter: "genre=rpg"}
+
+			var metadata Metadata
+			f.cursors(&metadata, keys[:len(tt.ids)], tt.ids, tt.more)
+
+			checkCursor(t, "next", metadata.NextCursor, tt.wantNext, key)
+			checkCursor(t, "prev", metadata.PrevCursor, tt.wantPrev, key)
+		})
+	}
+}
+
+func checkCursor(t *testing.T, name, encoded string, want *Cursor, key []byte) {
+	t.Helper()
+
+	if want == nil {
+		if encoded != "" {
+			t.Errorf("unexpected %s cursor", name)
+		}
+		return
+	}
+
+	got, err := DecodeCursor(encoded, key)
+	if err != nil {
+		t.Errorf("%s cursor: %v", name, err)
+		return
+	}
+	if *got != *want {
+		t.Errorf("%s cursor = %+v, want %+v", name, *got, *want)
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	safelist := []string{"id", "title", "-id", "-title"}
+
+	tests := []struct {
+		name    string
+		filters Filters
+		wantErr string
+	}{
+		{name: "valid", filters: Filters{Page: 1, PageSize: 20, Sort: "-title"}},
+		{name: "largest", filters: Filters{Page: 10_000_000, PageSize: 100, Sort: "id"}},
+		{name: "page zero", filters: Filters{Page: 0, PageSize: 20, Sort: "id"}, wantErr: "page"},
+		{name: "page too large", filters: Filters{Page: 10_000_001, PageSize: 20, Sort: "id"}, wantErr: "page"},
+		{name: "page size zero", filters: Filters{Page: 1, PageSize: 0, Sort: "id"}, wantErr: "page_size"},
+		{name: "page size too large", filters: Filters{Page: 1, PageSize: 101, Sort: "id"}, wantErr: "page_size"},
+		{name: "unsafe sort", filters: Filters{Page: 1, PageSize: 20, Sort: "price; DROP TABLE games"}, wantErr: "sort"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filters.SortSafelist = safelist
+
+			v := validator.New()
+			ValidateFilters(v, tt.filters)
+
+			if tt.wantErr == "" && !v.Valid() {
+				t.Fatalf("unexpected errors %v", v.Errors)
+			}
+			if _, ok := v.Errors[tt.wantErr]; tt.wantErr != "" && !ok {
+				t.Fatalf("want an error for %q, got %v", tt.wantErr, v.Errors)
+			}
+		})
+	}
+}
+
+func TestSortColumnPanicsOnUnsafeSort(t *testing.T) {
+	f := Filters{Sort: "-title", SortSafelist: []string{"title", "-title"}}
+	if got := f.sortColumn(); got != "title" {
+		t.Fatalf("sortColumn = %q, want title", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+
+	Filters{Sort: "price", SortSafelist: []string{"title"}}.sortColumn()
+}
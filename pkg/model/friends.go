@@ -0,0 +1,437 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	FriendRequestPending  = "pending"
+	FriendRequestAccepted = "accepted"
+)
+
+var (
+	ErrAlreadyFriends   = errors.New("already friends")
+	ErrDuplicateRequest = errors.New("duplicate friend request")
+	ErrBlocked          = errors.New("blocked")
+)
+
+type FriendRequest struct {
+	Id          int64     `json:"id"`
+	RequesterID int64     `json:"requester_id"`
+	AddresseeID int64     `json:"addressee_id"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	// The other party from the point of view of the user listing requests.
+	User *PublicUser `json:"user,omitempty"`
+}
+
+// PublicUser is what other users may see of an account.
+type PublicUser struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type Friend struct {
+	PublicUser
+	Since time.Time `json:"since"`
+}
+
+type FriendModel struct {
+	DB *sql.DB
+}
+
+// SendRequest creates a friend request. If the other user has already asked
+// to be friends, their request is accepted instead.
+func (m FriendModel) SendRequest(from, to int64) (*FriendRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var blocked bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`
+	err = tx.QueryRowContext(ctx, query, from, to).Scan(&blocked)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+
+	request, err := lockFriendRequest(ctx, tx, from, to)
+	if errors.Is(err, ErrRecordNotFound) {
+		query = `
+			INSERT INTO friend_requests (requester_id, addressee_id)
+			VALUES ($1, $2)
+			ON CONFLICT (LEAST(requester_id, addressee_id), GREATEST(requester_id, addressee_id)) DO NOTHING
+			RETURNING id, requester_id, addressee_id, status, created_at
+		`
+		request = &FriendRequest{}
+		err = tx.QueryRowContext(ctx, query, from, to).Scan(
+			&request.Id,
+			&request.RequesterID,
+			&request.AddresseeID,
+			&request.Status,
+			&request.CreatedAt,
+		)
+		if err == nil {
+			return request, tx.Commit()
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		// A request between the two users was committed since the lookup,
+		// most likely the other user asking at the same time. Handle it like
+		// any existing request.
+		request, err = lockFriendRequest(ctx, tx, from, to)
+	}
+
+	switch {
+	case err != nil:
+		return nil, err
+	case request.Status == FriendRequestAccepted:
+		return nil, ErrAlreadyFriends
+	case request.RequesterID == from:
+		return nil, ErrDuplicateRequest
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE friend_requests SET status = $1, accepted_at = NOW() WHERE id = $2`, FriendRequestAccepted, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	request.Status = FriendRequestAccepted
+
+	return request, tx.Commit()
+}
+
+// lockFriendRequest locks the request between two users, whichever of them
+// sent it.
+func lockFriendRequest(ctx context.Context, tx *sql.Tx, a, b int64) (*FriendRequest, error) {
+	query := `
+		SELECT id, requester_id, addressee_id, status, created_at
+		FROM friend_requests
+		WHERE LEAST(requester_id, addressee_id) = LEAST($1::bigint, $2::bigint)
+		AND GREATEST(requester_id, addressee_id) = GREATEST($1::bigint, $2::bigint)
+		FOR UPDATE
+	`
+
+	var request FriendRequest
+
+	err := tx.QueryRowContext(ctx, query, a, b).Scan(
+		&request.Id,
+		&request.RequesterID,
+		&request.AddresseeID,
+		&request.Status,
+		&request.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &request, nil
+}
+
+// GetPendingRequests returns the pending requests sent to and by the user.
+func (m FriendModel) GetPendingRequests(userID int64) (incoming, outgoing []*FriendRequest, err error) {
+	query := `
+		SELECT fr.id, fr.requester_id, fr.addressee_id, fr.status, fr.created_at, u.id, u.name
+		FROM friend_requests fr
+		INNER JOIN users u ON u.id = CASE WHEN fr.requester_id = $1 THEN fr.addressee_id ELSE fr.requester_id END
+		WHERE (fr.requester_id = $1 OR fr.addressee_id = $1) AND fr.status = $2 AND u.deleted_at IS NULL
+		ORDER BY fr.created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, FriendRequestPending)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	incoming = []*FriendRequest{}
+	outgoing = []*FriendRequest{}
+
+	for rows.Next() {
+		request := FriendRequest{User: &PublicUser{}}
+		err := rows.Scan(
+			&request.Id,
+			&request.RequesterID,
+			&request.AddresseeID,
+			&request.Status,
+			&request.CreatedAt,
+			&request.User.Id,
+			&request.User.Name,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if request.AddresseeID == userID {
+			incoming = append(incoming, &request)
+		} else {
+			outgoing = append(outgoing, &request)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return incoming, outgoing, nil
+}
+
+// Respond accepts or declines a pending request addressed to the user. A
+// declined request is deleted so it can be sent again later.
+func (m FriendModel) Respond(requestID, userID int64, accept bool) error {
+	query := `
+		DELETE FROM friend_requests
+		WHERE id = $1 AND addressee_id = $2 AND status = $3
+	`
+	args := []interface{}{requestID, userID, FriendRequestPending}
+
+	if accept {
+		query = `
+			UPDATE friend_requests
+			SET status = $4, accepted_at = NOW()
+			WHERE id = $1 AND addressee_id = $2 AND status = $3
+		`
+		args = append(args, FriendRequestAccepted)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m FriendModel) GetFriends(userID int64) ([]*Friend, error) {
+	query := `
+		SELECT u.id, u.name, fr.accepted_at
+		FROM friend_requests fr
+		INNER JOIN users u ON u.id = CASE WHEN fr.requester_id = $1 THEN fr.addressee_id ELSE fr.requester_id END
+		WHERE (fr.requester_id = $1 OR fr.addressee_id = $1) AND fr.status = $2 AND u.deleted_at IS NULL
+		ORDER BY u.name, u.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, FriendRequestAccepted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	friends := []*Friend{}
+
+	for rows.Next() {
+		var friend Friend
+		err := rows.Scan(&friend.Id, &friend.Name, &friend.Since)
+		if err != nil {
+			return nil, err
+		}
+		friends = append(friends, &friend)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return friends, nil
+}
+
+func (m FriendModel) AreFriends(a, b int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM friend_requests
+			WHERE LEAST(requester_id, addressee_id) = LEAST($1::bigint, $2::bigint)
+			AND GREATEST(requester_id, addressee_id) = GREATEST($1::bigint, $2::bigint)
+			AND status = $3
+		)
+	`
+
+	var friends bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, a, b, FriendRequestAccepted).Scan(&friends)
+	return friends, err
+}
+
+func (m FriendModel) Remove(userID, friendID int64) error {
+	query := `
+		DELETE FROM friend_requests
+		WHERE LEAST(requester_id, addressee_id) = LEAST($1::bigint, $2::bigint)
+		AND GREATEST(requester_id, addressee_id) = GREATEST($1::bigint, $2::bigint)
+		AND status = $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, friendID, FriendRequestAccepted)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Block blocks the other user and drops any friendship or pending request
+// between the two.
+func (m FriendModel) Block(blockerID, blockedID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO blocks (blocker_id, blocked_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err = tx.ExecContext(ctx, query, blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM friend_requests
+		WHERE LEAST(requester_id, addressee_id) = LEAST($1::bigint, $2::bigint)
+		AND GREATEST(requester_id, addressee_id) = GREATEST($1::bigint, $2::bigint)
+	`
+	_, err = tx.ExecContext(ctx, query, blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m FriendModel) Unblock(blockerID, blockedID int64) error {
+	query := `
+		DELETE FROM blocks
+		WHERE blocker_id = $1 AND blocked_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m FriendModel) GetBlocked(blockerID int64) ([]*PublicUser, error) {
+	query := `
+		SELECT u.id, u.name
+		FROM blocks b
+		INNER JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*PublicUser{}
+
+	for rows.Next() {
+		var user PublicUser
+		err := rows.Scan(&user.Id, &user.Name)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// IsBlocked reports whether either user has blocked the other.
+func (m FriendModel) IsBlocked(a, b int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`
+
+	var blocked bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, a, b).Scan(&blocked)
+	return blocked, err
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+var PlatformSafelist = []string{"windows", "macos", "linux", "playstation", "xbox", "switch", "android", "ios"}
+
+// LanguageRX matches ISO 639-1 language codes with an optional region, like
+// "en" or "pt-BR".
+var LanguageRX = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+
+// ageRatings maps the ratings of each supported system to the minimum age
+// they imply.
+var ageRatings = map[string]map[string]int{
+	"PEGI": {"3": 3, "7": 7, "12": 12, "16": 16, "18": 18},
+	"ESRB": {"EC": 3, "E": 6, "E10+": 10, "T": 13, "M": 17, "AO": 18},
+}
+
+type AgeRating struct {
+	System string `json:"system"`
+	Rating string `json:"rating"`
+}
+
+// MinimumAge returns the age the rating is meant for. ok is false for
+// unknown ratings.
+func (a AgeRating) MinimumAge() (age int, ok bool) {
+	age, ok = ageRatings[a.System][a.Rating]
+	return age, ok
+}
+
+// Rating is an age rating along with the age it is meant for. Games embed it
+// when asked for with include=rating.
+type Rating struct {
+	System     string `json:"system"`
+	Rating     string `json:"rating"`
+	MinimumAge int    `json:"minimumAge"`
+}
+
+// Embed returns the rating to embed in a game.
+func (a AgeRating) Embed() *Rating {
+	age, _ := a.MinimumAge()
+	return &Rating{System: a.System, Rating: a.Rating, MinimumAge: age}
+}
+
+func (a AgeRating) Value() (driver.Value, error) {
+	return a.System + " " + a.Rating, nil
+}
+
+func (a *AgeRating) Scan(src interface{}) error {
+	var s string
+
+	switch src := src.(type) {
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	default:
+		return fmt.Errorf("cannot scan %T into AgeRating", src)
+	}
+
+	system, rating, found := strings.Cut(s, " ")
+	if !found {
+		return fmt.Errorf("invalid age rating %q", s)
+	}
+
+	a.System, a.Rating = system, rating
+	return nil
+}
+
+type Requirements struct {
+	OS        string `json:"os,omitempty"`
+	Processor string `json:"processor,omitempty"`
+	Memory    string `json:"memory,omitempty"`
+	Graphics  string `json:"graphics,omitempty"`
+	Storage   string `json:"storage,omitempty"`
+}
+
+type SystemRequirements struct {
+	Minimum     *Requirements `json:"minimum,omitempty"`
+	Recommended *Requirements `json:"recommended,omitempty"`
+}
+
+func (r SystemRequirements) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *SystemRequirements) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, r)
+	case string:
+		return json.Unmarshal([]byte(src), r)
+	default:
+		return errors.New("cannot scan system requirements")
+	}
+}
+
+func validateGameMetadata(v *validator.Validator, game *Game) {
+	v.Check(len(game.ShortDescription) <= 300, "shortDescription", "must not be more than 300 bytes long")
+	v.Check(len(game.Description) <= 20000, "description", "must not be more than 20000 bytes long")
+	v.Check(len(game.Developer) <= 200, "developer", "must not be more than 200 bytes long")
+
+	v.Check(validator.Unique(game.Platforms), "platforms", "must not contain duplicate values")
+	for _, platform := range game.Platforms {
+		v.Check(validator.In(platform, PlatformSafelist...), "platforms", "must only contain "+strings.Join(PlatformSafelist, ", "))
+	}
+
+	v.Check(validator.Unique(game.Languages), "languages", "must not contain duplicate values")
+	for _, language := range game.Languages {
+		v.Check(validator.Matches(language, LanguageRX), "languages", "must only contain ISO 639-1 codes like en or pt-BR")
+	}
+
+	if game.AgeRating != nil {
+		_, ok := game.AgeRating.MinimumAge()
+		v.Check(ok, "ageRating", "must be a PEGI (3, 7, 12, 16, 18) or ESRB (EC, E, E10+, T, M, AO) rating")
+	}
+
+	for key, requirements := range map[string]*Requirements{
+		"systemRequirements.minimum":     game.SystemRequirements.Minimum,
+		"systemRequirements.recommended": game.SystemRequirements.Recommended,
+	} {
+		if requirements == nil {
+			continue
+		}
+		for _, field := range []string{requirements.OS, requirements.Processor, requirements.Memory, requirements.Graphics, requirements.Storage} {
+			v.Check(len(field) <= 200, key, "must not contain values more than 200 bytes long")
+		}
+	}
+
+	for key, urls := range map[string][]string{"screenshots": game.Screenshots, "trailers": game.Trailers} {
+		v.Check(len(urls) <= 20, key, "must not contain more than 20 URLs")
+		for _, u := range urls {
+			v.Check(validator.IsURL(u), key, "must only contain http or https URLs")
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package model
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GameSearch holds the filters of a game listing. PublisherId, MaxAgeRating,
+// MinPrice and MaxPrice are -1 when not filtered on.
+type GameSearch struct {
+	Title           string
+	Query           string
+	Genres          []string
+	PublisherId     int
+	Platform        string
+	Language        string
+	MaxAgeRating    int
+	Tag             string
+	MinPrice        float64
+	MaxPrice        float64
+	ReleaseDateFrom *time.Time
+	ReleaseDateTo   *time.Time
+}
+
+// gameRank scores how well a game matches the search query: full-text rank
+// over title and description, plus how closely a word in the title matches
+// the query, which also covers prefixes and typos.
+const gameRank = `(ts_rank(g.search, websearch_to_tsquery('simple', $8)) + word_similarity($8, g.title))`
+
+// sql returns the WITH and WHERE clauses of a search over games as g, and
+// their arguments. Queries add their own arguments after these. Delisted
+// games are never found.
+func (search GameSearch) sql() (with, where string, args []interface{}) {
+	with = `WITH RECURSIVE ` + genreTree("$2")
+
+	where = `
+		WHERE g.status <> 'delisted'
+		AND (to_tsvector('simple', g.title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND ` + genreFilter("$2", "g.genres") + `
+		AND (g.publisher_id = $3 OR $3 = -1)
+		AND (g.platforms @> ARRAY[$4::text] OR $4 = '')
+		AND (g.languages @> ARRAY[$5::text] OR $5 = '')
+		AND (g.min_age <= $6 OR $6 = -1)
+		AND ($7 = '' OR EXISTS (
+			SELECT 1 FROM game_tags gt
+			INNER JOIN tags t ON t.id = gt.tag_id
+			WHERE gt.game_id = g.id AND t.slug = $7
+		))
+		AND ($8 = '' OR g.search @@ websearch_to_tsquery('simple', $8) OR $8 <% g.title)
+		AND (g.price >= $9 OR $9 = -1)
+		AND (g.price <= $10 OR $10 = -1)
+		AND (g.release_date >= $11 OR $11 IS NULL)
+		AND (g.release_date < $12::timestamptz + interval '1 day' OR $12 IS NULL)
+	`
+
+	args = []interface{}{
+		search.Title,
+		pq.Array(search.Genres),
+		search.PublisherId,
+		search.Platform,
+		search.Language,
+		search.MaxAgeRating,
+		search.Tag,
+		search.Query,
+		search.MinPrice,
+		search.MaxPrice,
+		search.ReleaseDateFrom,
+		search.ReleaseDateTo,
+	}
+
+	return with, where, args
+}
+
+type GenreFacet struct {
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type PublisherFacet struct {
+	Id    int64  `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// PriceFacet counts the games priced from Min up to, but not including,
+// Max. The first bucket holds the free games and the last one has no Max.
+type PriceFacet struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int      `json:"count"`
+}
+
+type Facets struct {
+	Genres     []GenreFacet     `json:"genres"`
+	Publishers []PublisherFacet `json:"publishers"`
+	Prices     []PriceFacet     `json:"prices"`
+}
+
+// priceBuckets are the upper bounds of the price facets. Free games get a
+// bucket of their own.
+var priceBuckets = []float64{0, 10, 30, 60}
+
+// Facets counts the games matching a search per genre, publisher and price
+// bucket, ignoring pagination.
+func (m GameModel) Facets(search GameSearch) (*Facets, error) {
+	with, where, args := search.sql()
+
+	query := with + `,
+		matches AS (
+			SELECT g.id, g.genres, g.publisher_id, g.price
+			FROM games g
+			` + where + `
+		)
+		SELECT 'genre', gn.slug, gn.name, count(*)
+		FROM matches m
+		CROSS JOIN LATERAL unnest(m.genres) AS mg(slug)
+		INNER JOIN genres gn ON gn.slug = mg.slug
+		GROUP BY gn.slug, gn.name
+		UNION ALL
+		SELECT 'publisher', p.id::text, p.name, count(*)
+		FROM matches m
+		INNER JOIN publishers p ON p.id = m.publisher_id
+		GROUP BY p.id, p.name
+		UNION ALL
+		SELECT 'price', b.bucket::text, '', count(*)
+		FROM (
+			SELECT CASE
+				WHEN m.price = 0 THEN 0
+				WHEN m.price < 10 THEN 1
+				WHEN m.price < 30 THEN 2
+				WHEN m.price < 60 THEN 3
+				ELSE 4
+			END AS bucket
+			FROM matches m
+		) b
+		GROUP BY b.bucket
+		ORDER BY 1, 4 DESC, 3, 2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &Facets{
+		Genres:     []GenreFacet{},
+		Publishers: []PublisherFacet{},
+		Prices:     []PriceFacet{},
+	}
+
+	prices := make([]int, len(priceBuckets)+1)
+
+	for rows.Next() {
+		var kind, key, name string
+		var count int
+
+		err := rows.Scan(&kind, &key, &name, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case "genre":
+			facets.Genres = append(facets.Genres, GenreFacet{Slug: key, Name: name, Count: count})
+		case "publisher":
+			id, _ := strconv.ParseInt(key, 10, 64)
+			facets.Publishers = append(facets.Publishers, PublisherFacet{Id: id, Name: name, Count: count})
+		case "price":
+			bucket, _ := strconv.Atoi(key)
+			prices[bucket] = count
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, count := range prices {
+		if count == 0 {
+			continue
+		}
+
+		facet := PriceFacet{Count: count}
+		if i > 0 {
+			facet.Min = priceBuckets[i-1]
+		}
+		if i < len(priceBuckets) {
+			max := priceBuckets[i]
+			facet.Max = &max
+		}
+		facets.Prices = append(facets.Prices, facet)
+	}
+
+	return facets, nil
+}
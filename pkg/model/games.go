@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"regexp"
 	"time"
 	"fmt"
 
@@ -14,35 +15,159 @@ import (
 
 type Game struct {
 	Id          int64    `json:"id"`
+	SKU         string    `json:"sku,omitempty"`
 	Title       string    `json:"title"`
 	CreatedAt   time.Time `json:"-"`
 	Genres      []string  `json:"genres"`
 	ReleaseDate time.Time `json:"releaseDate"`
 	Price       float64   `json:"price"`
 	PublisherId int       `json:"publisherId"`
+	ShortDescription   string             `json:"shortDescription"`
+	Description        string             `json:"description"`
+	Developer          string             `json:"developer"`
+	Platforms          []string           `json:"platforms"`
+	Languages          []string           `json:"languages"`
+	AgeRating          *AgeRating         `json:"ageRating"`
+	SystemRequirements SystemRequirements `json:"systemRequirements"`
+	Screenshots        []string           `json:"screenshots"`
+	Trailers           []string           `json:"trailers"`
 	Version     int32     `json:"version"`
+	Kind        string    `json:"kind"`
+	// The game a DLC belongs to.
+	BaseGameId *int64 `json:"baseGameId,omitempty"`
+	// The games and DLC an edition comes with.
+	Includes []int64 `json:"includes,omitempty"`
+	Status   string  `json:"status"`
+	// Only set when asked for with include=publisher.
+	Publisher *Publisher `json:"publisher,omitempty"`
+	// Only set when asked for with include=rating, and the game is rated.
+	Rating *Rating `json:"rating,omitempty"`
 }
 
+// GameFields are the JSON fields of a game that can be picked with fields=.
+var GameFields = []string{"id", "sku", "title", "genres", "releaseDate", "price", "publisherId", "shortDescription",
+	"description", "developer", "platforms", "languages", "ageRating", "systemRequirements", "screenshots",
+	"trailers", "version", "kind", "baseGameId", "includes", "status"}
+
+const (
+	KindGame    = "game"
+	KindDLC     = "dlc"
+	KindEdition = "edition"
+)
+
+var GameKinds = []string{KindGame, KindDLC, KindEdition}
+
+// Announced games are listed but can't be bought yet, pre-order games can be
+// bought before their release date, and delisted games are no longer sold.
+const (
+	StatusAnnounced = "announced"
+	StatusPreOrder  = "pre-order"
+	StatusReleased  = "released"
+	StatusDelisted  = "delisted"
+)
+
+var GameStatuses = []string{StatusAnnounced, StatusPreOrder, StatusReleased, StatusDelisted}
+
+// gameColumns lists the columns scanned by Game.scanDest, for queries
+// selecting from games as g.
+const gameColumns = `g.id, g.created_at, g.title, g.genres, g.price, g.release_date, g.publisher_id, g.version,
+	g.short_description, g.description, g.developer, g.platforms, g.languages, g.age_rating,
+	g.system_requirements, g.screenshots, g.trailers, COALESCE(g.sku, ''), g.kind, g.base_game_id,
+	ARRAY(SELECT gi.included_id FROM game_includes gi WHERE gi.game_id = g.id ORDER BY gi.included_id), g.status`
+
+func (game *Game) scanDest() []interface{} {
+	return []interface{}{
+		&game.Id,
+		&game.CreatedAt,
+		&game.Title,
+		pq.Array(&game.Genres),
+		&game.Price,
+		&game.ReleaseDate,
+		&game.PublisherId,
+		&game.Version,
+		&game.ShortDescription,
+		&game.Description,
+		&game.Developer,
+		pq.Array(&game.Platforms),
+		pq.Array(&game.Languages),
+		&game.AgeRating,
+		&game.SystemRequirements,
+		pq.Array(&game.Screenshots),
+		pq.Array(&game.Trailers),
+		&game.SKU,
+		&game.Kind,
+		&game.BaseGameId,
+		pq.Array(&game.Includes),
+		&game.Status,
+	}
+}
+
+// minAge is stored next to the age rating so games can be filtered by it.
+func (game *Game) minAge() *int {
+	if game.AgeRating == nil {
+		return nil
+	}
+
+	age, ok := game.AgeRating.MinimumAge()
+	if !ok {
+		return nil
+	}
+
+	return &age
+}
+
+var (
+	ErrDuplicateSKU = errors.New("duplicate sku")
+	ErrGameOwned    = errors.New("game is owned")
+	ErrGameHasDLC   = errors.New("game has dlc")
+	ErrGameIncluded = errors.New("game is included in editions or bundles")
+)
+
+var SKURX = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
 type GameModel struct {
 	DB       *sql.DB
 	InfoLog  *log.Logger
 	ErrorLog *log.Logger
 }
 
-func (m GameModel) GetAll(title string, genres []string, publisher_id int, filters Filters) ([]*Game, Metadata, error) {
+// GetAll pages through games by offset, or after or before filters.Cursor.
+// Only offset pages count the total number of records, which gets slow on
+// deep pages.
+func (m GameModel) GetAll(search GameSearch, filters Filters) ([]*Game, Metadata, error) {
+	sortKey := "g." + filters.sortColumn()
+	if filters.sortColumn() == "relevance" {
+		// Most relevant first.
+		sortKey = "-" + gameRank
+	}
+
+	with, where, args := search.sql()
+
+	keyset, orderBy := filters.keyset(sortKey, "g.id", "$15", "$16")
+
+	count := "count(*) OVER()"
+	if filters.Cursor != nil {
+		count = "0"
+	}
+
+	// One more row than asked for tells whether there is another page.
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, genres, price, release_date, publisher_id, version
-		FROM games
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (genres @> $2 OR $2 = '{}')
-		AND (publisher_id = $3 OR $3 = -1)
-		ORDER BY %s %s, id ASC
-		LIMIT $4 OFFSET $5
-	`, filters.sortColumn(), filters.sortDirection())
+		%s
+		SELECT %s, (%s)::text, `+gameColumns+`
+		FROM games g
+		%s
+		%s
+		ORDER BY %s
+		LIMIT $13 OFFSET $14
+	`, with, count, sortKey, where, keyset, orderBy)
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	
-	args := []interface{}{title, pq.Array(genres), publisher_id, filters.limit(), filters.offset()}
+
+	if filters.Cursor != nil {
+		args = append(args, filters.limit()+1, 0, filters.Cursor.Value, filters.Cursor.Id)
+	} else {
+		args = append(args, filters.limit()+1, filters.offset())
+	}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -52,39 +177,51 @@ func (m GameModel) GetAll(title string, genres []string, publisher_id int, filte
 
 	totalRecords := 0
 	var games []*Game
+	var keys []string
+	var ids []int64
 
 	for rows.Next() {
 		var game Game
-		err := rows.Scan(
-			&totalRecords,
-			&game.Id, 
-			&game.CreatedAt,
-			&game.Title, 
-			pq.Array(&game.Genres), 
-			&game.Price, 
-			&game.ReleaseDate, 
-			&game.PublisherId,
-			&game.Version,
-		)
+		var key string
+		err := rows.Scan(append([]interface{}{&totalRecords, &key}, game.scanDest()...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 		games = append(games, &game)
+		keys = append(keys, key)
+		ids = append(ids, game.Id)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
 
+	more := len(games) > filters.limit()
+	if more {
+		games, keys, ids = games[:filters.limit()], keys[:filters.limit()], ids[:filters.limit()]
+	}
+
+	if filters.Cursor != nil && filters.Cursor.Before {
+		for i, j := 0, len(games)-1; i < j; i, j = i+1, j-1 {
+			games[i], games[j] = games[j], games[i]
+			keys[i], keys[j] = keys[j], keys[i]
+			ids[i], ids[j] = ids[j], ids[i]
+		}
+	}
+
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	if filters.Cursor != nil {
+		metadata = Metadata{PageSize: filters.PageSize}
+	}
+	filters.cursors(&metadata, keys, ids, more)
 
 	return games, metadata, nil
 }
 
 func (m GameModel) Get(id int) (*Game, error) {
 	query := `
-		SELECT id, created_at, title, genres, price, release_date, publisher_id, version
-		FROM games
+		SELECT ` + gameColumns + `
+		FROM games g
 		WHERE id = $1 
 	`
 	var game Game
@@ -92,16 +229,7 @@ func (m GameModel) Get(id int) (*Game, error) {
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&game.Id, 
-		&game.CreatedAt,
-		&game.Title, 
-		pq.Array(&game.Genres), 
-		&game.Price, 
-		&game.ReleaseDate, 
-		&game.PublisherId,
-		&game.Version,
-	)
+	err := row.Scan(game.scanDest()...)
 	if err != nil {
 		switch{
 		case errors.Is(err, sql.ErrNoRows):
@@ -116,24 +244,65 @@ func (m GameModel) Get(id int) (*Game, error) {
 
 func (m GameModel) Post(game *Game) error {
 	query := `
-		INSERT INTO games (title, genres, price, release_date, publisher_id)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, version
+		WITH next AS (
+			SELECT nextval(pg_get_serial_sequence('games', 'id')) AS id
+		)
+		INSERT INTO games (id, title, genres, price, release_date, publisher_id, short_description, description,
+			developer, platforms, languages, age_rating, min_age, system_requirements, screenshots, trailers, sku,
+			kind, base_game_id, status)
+		SELECT next.id, $1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9::text[], '{}'), COALESCE($10::text[], '{}'), $11,
+			$12, $13, COALESCE($14::text[], '{}'), COALESCE($15::text[], '{}'), COALESCE(NULLIF($16, ''), 'game-' || next.id),
+			$17, $18, $19
+		FROM next
+		RETURNING id, created_at, version, sku
 	`
-	args := []interface{}{game.Title, pq.Array(game.Genres), game.Price, game.ReleaseDate, game.PublisherId}
+	args := []interface{}{
+		game.Title,
+		pq.Array(game.Genres),
+		game.Price,
+		game.ReleaseDate,
+		game.PublisherId,
+		game.ShortDescription,
+		game.Description,
+		game.Developer,
+		pq.Array(game.Platforms),
+		pq.Array(game.Languages),
+		game.AgeRating,
+		game.minAge(),
+		game.SystemRequirements,
+		pq.Array(game.Screenshots),
+		pq.Array(game.Trailers),
+		game.SKU,
+		game.Kind,
+		game.BaseGameId,
+		game.Status,
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&game.Id, &game.CreatedAt, &game.Version)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&game.Id, &game.CreatedAt, &game.Version, &game.SKU)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "games_sku_key"`:
+			return ErrDuplicateSKU
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
 
 
 func (m GameModel) Update(game *Game) error {
 	query := `
 		UPDATE games
-		SET title = $1, genres = $2, price = $3, release_date = $4, publisher_id = $5, version = version + 1
-		WHERE id = $6 AND version = $7
-		RETURNING version
+		SET title = $1, genres = $2, price = $3, release_date = $4, publisher_id = $5,
+			short_description = $6, description = $7, developer = $8, platforms = $9, languages = $10,
+			age_rating = $11, min_age = $12, system_requirements = $13, screenshots = $14, trailers = $15,
+			sku = COALESCE(NULLIF($18, ''), sku), kind = $19, base_game_id = $20, status = $21, version = version + 1
+		WHERE id = $16 AND version = $17
+		RETURNING version, sku
 	`
 
 	args := []interface{}{
@@ -142,18 +311,34 @@ func (m GameModel) Update(game *Game) error {
 		game.Price,
 		game.ReleaseDate, 
 		game.PublisherId, 
+		game.ShortDescription,
+		game.Description,
+		game.Developer,
+		pq.Array(game.Platforms),
+		pq.Array(game.Languages),
+		game.AgeRating,
+		game.minAge(),
+		game.SystemRequirements,
+		pq.Array(game.Screenshots),
+		pq.Array(game.Trailers),
 		game.Id,
 		game.Version,
+		game.SKU,
+		game.Kind,
+		game.BaseGameId,
+		game.Status,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&game.Version)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&game.Version, &game.SKU)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "games_sku_key"`:
+			return ErrDuplicateSKU
 		default:
 			return err
 		}
@@ -162,35 +347,207 @@ func (m GameModel) Update(game *Game) error {
 	return nil
 }
 
+// Delete delists a game. It disappears from listings and search but stays
+// in its owners' libraries; Purge removes it for good. Pending pre-orders of
+// the game are cancelled and refunded, as they can no longer be fulfilled.
 func (m GameModel) Delete(id int) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE games
+		SET status = 'delisted',
+			status_before_delist = CASE WHEN status = 'delisted' THEN status_before_delist ELSE status END,
+			version = version + 1
+		WHERE id = $1
+	`
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	query = `
+		WITH cancelled AS (
+			UPDATE preorders
+			SET status = 'cancelled', closed_at = NOW()
+			WHERE game_id = $1 AND status = 'pending'
+			RETURNING user_id, price
+		)
+		UPDATE wallet w
+		SET balance = w.balance + r.refund
+		FROM (
+			SELECT user_id, sum(price) AS refund
+			FROM cancelled
+			GROUP BY user_id
+		) r
+		WHERE w.id = r.user_id
+	`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Restore lists a delisted game again: as released once its release date has
+// passed, otherwise as a pre-order if it was on pre-order when delisted and
+// as announced if not.
+func (m GameModel) Restore(id int) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE games
+		SET status = CASE
+				WHEN release_date <= NOW() THEN 'released'
+				WHEN status_before_delist = 'pre-order' THEN 'pre-order'
+				ELSE 'announced'
+			END,
+			status_before_delist = NULL,
+			version = version + 1
+		WHERE id = $1 AND status = 'delisted'
+	`
+
+	return m.execForGame(query, id)
+}
+
+// Purge deletes a delisted game for good. It returns ErrGameOwned while the
+// game is in anyone's library or pre-orders, ErrGameHasDLC while DLC still
+// refers to it and ErrGameIncluded while editions or bundles include it.
+func (m GameModel) Purge(id int) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM games
+		WHERE id = $1 AND status = 'delisted'
+	`
+
+	err := m.execForGame(query, id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: update or delete on table "games" violates foreign key constraint "library_game_id_fkey" on table "library"`,
+			err.Error() == `pq: update or delete on table "games" violates foreign key constraint "preorders_game_id_fkey" on table "preorders"`:
+			return ErrGameOwned
+		case err.Error() == `pq: update or delete on table "games" violates foreign key constraint "games_base_game_id_fkey" on table "games"`:
+			return ErrGameHasDLC
+		case err.Error() == `pq: update or delete on table "games" violates foreign key constraint "game_includes_included_id_fkey" on table "game_includes"`,
+			err.Error() == `pq: update or delete on table "games" violates foreign key constraint "bundle_games_game_id_fkey" on table "bundle_games"`:
+			return ErrGameIncluded
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CountOwners counts the users who own the game or have pre-ordered it.
+func (m GameModel) CountOwners(id int) (int, error) {
 	query := `
-		DELETE FROM games WHERE id = $1
+		SELECT count(DISTINCT user_id)
+		FROM (
+			SELECT user_id FROM library WHERE game_id = $1
+			UNION ALL
+			SELECT user_id FROM preorders WHERE game_id = $1
+		) owners
 	`
 
+	var owners int
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&owners)
+	return owners, err
+}
 
-	return err
+func (m GameModel) execForGame(query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
 }
 
-func ValidateGame(v *validator.Validator, game *Game) {
+// ValidateGame checks a game against the slugs of the known genres.
+func ValidateGame(v *validator.Validator, game *Game, genres []string) {
 	v.Check(game.Title != "", "title", "must be provided")
 	v.Check(len(game.Title) <= 500, "title", "must not be more than 500 bytes long")
-	v.Check(game.ReleaseDate.Before(time.Now()), "releaseDate", "must be a date before today")
+	v.Check(!game.ReleaseDate.IsZero(), "releaseDate", "must be provided")
+	v.Check(validator.In(game.Status, GameStatuses...), "status", "must be announced, pre-order, released or delisted")
+	switch game.Status {
+	case StatusReleased:
+		v.Check(game.ReleaseDate.Before(time.Now()), "releaseDate", "must be a date before today for released games")
+	case StatusAnnounced, StatusPreOrder:
+		v.Check(game.ReleaseDate.After(time.Now()), "releaseDate", "must be a future date for upcoming games")
+	}
 	v.Check(game.Price >= 0, "price", "must be at least zero")
 	v.Check(game.PublisherId > 0, "publisherId", "must be a positive integer")
 	v.Check(len(game.Genres) > 0, "genres", "must contain at least one genre")
+	v.Check(validator.Unique(game.Genres), "genres", "must not contain duplicate values")
+	for _, genre := range game.Genres {
+		v.Check(validator.In(genre, genres...), "genres", "must only contain known genres, see GET /genres")
+	}
+
+	if game.SKU != "" {
+		v.Check(len(game.SKU) <= 64, "sku", "must not be more than 64 bytes long")
+		v.Check(validator.Matches(game.SKU, SKURX), "sku", "must only contain letters, digits, dots, dashes and underscores")
+	}
+
+	v.Check(validator.In(game.Kind, GameKinds...), "kind", "must be game, dlc or edition")
+	if game.Kind == KindDLC {
+		v.Check(game.BaseGameId != nil, "baseGameId", "must be provided for DLC")
+	} else {
+		v.Check(game.BaseGameId == nil, "baseGameId", "must only be set for DLC")
+	}
+	if game.BaseGameId != nil {
+		v.Check(*game.BaseGameId != game.Id, "baseGameId", "must not be the game itself")
+	}
+
+	validateGameMetadata(v, game)
 }
 
 func (m GameModel) GetAllOfUser(userId int64) ([]*Game, error) {
 	query := `
-		SELECT g.id, g.title, g.created_at, g.genres, g.price, g.release_date, g.publisher_id, g.version
+		SELECT ` + gameColumns + `
 		FROM games g
 		JOIN library l ON g.id = l.game_id
 		WHERE l.user_id = $1
@@ -207,16 +564,7 @@ func (m GameModel) GetAllOfUser(userId int64) ([]*Game, error) {
 	var games []*Game
 	for rows.Next() {
 		var game Game
-		err := rows.Scan(
-			&game.Id, 
-			&game.Title, 
-			&game.CreatedAt, 
-			pq.Array(&game.Genres), 
-			&game.Price, 
-			&game.ReleaseDate, 
-			&game.PublisherId,
-			&game.Version,
-		)
+		err := rows.Scan(game.scanDest()...)
 		if err != nil {
 			return nil, err
 		}
@@ -230,50 +578,54 @@ func (m GameModel) GetAllOfUser(userId int64) ([]*Game, error) {
 	return games, nil
 }
 
-func (m GameModel) AddToLibrary(userId int64, gameId int) error {
+func (m GameModel) DeleteFromLibrary(userId int64, gameId int) error {
+	if userId < 1 || gameId < 1 {
+		return ErrRecordNotFound
+	}
+
 	query := `
-		SELECT id
-		FROM library
-		WHERE user_id = $1 AND game_id = $2
+		DELETE FROM library WHERE user_id = $1 AND game_id = $2
 	`
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	var id int 
-	row := m.DB.QueryRowContext(ctx, query, userId, gameId)
-	err := row.Scan(&id)
-	if err == nil {
-		return errors.New("game already in library")
-	}
-	if err != sql.ErrNoRows {
-		return err
-	}
-
 
-	query = `
-		INSERT INTO library (user_id, game_id)
-		VALUES ($1, $2)
-	`
-	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userId, gameId)
 
-	_, err = m.DB.ExecContext(ctx, query, userId, gameId)
-	
 	return err
 }
 
-func (m GameModel) DeleteFromLibrary(userId int64, gameId int) error {
-	if userId < 1 || gameId < 1 {
-		return ErrRecordNotFound
-	}
-
+// GetKinds returns the kind of each of the games that exist, keyed by id.
+func (m GameModel) GetKinds(ids []int64) (map[int64]string, error) {
 	query := `
-		DELETE FROM library WHERE user_id = $1 AND game_id = $2
+		SELECT id, kind
+		FROM games
+		WHERE id = ANY($1)
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, userId, gameId)
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return err
-}
\ No newline at end of file
+	kinds := make(map[int64]string)
+
+	for rows.Next() {
+		var id int64
+		var kind string
+		if err := rows.Scan(&id, &kind); err != nil {
+			return nil, err
+		}
+		kinds[id] = kind
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return kinds, nil
+}
@@ -0,0 +1,292 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+var (
+	ErrDuplicateGenre = errors.New("duplicate genre")
+	ErrGenreCycle     = errors.New("genre cycle")
+)
+
+// SlugRX matches lowercase slugs like "action-rpg".
+var SlugRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var slugSeparatorRX = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify turns a display name like "Open World" into "open-world".
+func Slugify(name string) string {
+	return strings.Trim(slugSeparatorRX.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+type Genre struct {
+	Id        int64     `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	ParentId  *int64    `json:"parentId"`
+	GameCount int       `json:"gameCount"`
+	CreatedAt time.Time `json:"-"`
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(len(genre.Slug) <= 50, "slug", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(genre.Slug, SlugRX), "slug", "must only contain lowercase letters, digits and dashes")
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+	if genre.ParentId != nil {
+		v.Check(*genre.ParentId != genre.Id, "parentId", "must not be the genre itself")
+	}
+}
+
+// genreTree expands every genre slug in the array parameter to itself and
+// all of its subgenres, keyed by the slug that was asked for. It's meant to
+// be used in a WITH RECURSIVE clause together with genreFilter. The recursive
+// queries over genres use UNION, so even a cycle can't make them run forever.
+func genreTree(param string) string {
+	return fmt.Sprintf(`genre_tree AS (
+			SELECT gn.slug AS root, gn.id, gn.slug
+			FROM genres gn
+			WHERE gn.slug = ANY(%[1]s::text[])
+			UNION
+			SELECT t.root, c.id, c.slug
+			FROM genres c
+			INNER JOIN genre_tree t ON c.parent_id = t.id
+		)`, param)
+}
+
+// genreFilter matches rows whose genres column has every genre in the array
+// parameter, or one of its subgenres. A filter on "shooter" matches games
+// in "fps".
+func genreFilter(param, column string) string {
+	return fmt.Sprintf(`NOT EXISTS (
+			SELECT 1 FROM unnest(%[1]s::text[]) AS want(slug)
+			WHERE NOT EXISTS (
+				SELECT 1 FROM genre_tree t
+				WHERE t.root = want.slug AND t.slug = ANY(%[2]s)
+			)
+		)`, param, column)
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns every genre. A genre's game count includes the games in
+// its subgenres.
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT id AS root, id, slug FROM genres
+			UNION
+			SELECT t.root, c.id, c.slug
+			FROM genres c
+			INNER JOIN tree t ON c.parent_id = t.id
+		)
+		SELECT gn.id, gn.slug, gn.name, gn.parent_id, gn.created_at, (
+			SELECT count(*) FROM games g
+			WHERE g.genres && ARRAY(SELECT t.slug FROM tree t WHERE t.root = gn.id)
+			AND g.status <> 'delisted'
+		)
+		FROM genres gn
+		ORDER BY gn.name, gn.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(
+			&genre.Id,
+			&genre.Slug,
+			&genre.Name,
+			&genre.ParentId,
+			&genre.CreatedAt,
+			&genre.GameCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// Slugs returns the slugs of all genres, for validating games.
+func (m GenreModel) Slugs() ([]string, error) {
+	query := `SELECT slug FROM genres`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var slugs []string
+
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		slugs = append(slugs, slug)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return slugs, nil
+}
+
+func (m GenreModel) Get(id int64) (*Genre, error) {
+	query := `
+		SELECT id, slug, name, parent_id, created_at
+		FROM genres
+		WHERE id = $1
+	`
+
+	var genre Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&genre.Id,
+		&genre.Slug,
+		&genre.Name,
+		&genre.ParentId,
+		&genre.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &genre, nil
+}
+
+// Insert returns ErrRecordNotFound if the parent genre doesn't exist.
+func (m GenreModel) Insert(genre *Genre) error {
+	query := `
+		INSERT INTO genres (slug, name, parent_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, genre.Slug, genre.Name, genre.ParentId).Scan(&genre.Id, &genre.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateGenre
+		case err.Error() == `pq: insert or update on table "genres" violates foreign key constraint "genres_parent_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Update changes a genre's name and parent. Slugs are stored on games, so
+// they can't be changed. It returns ErrGenreCycle if the new parent is one
+// of the genre's own subgenres.
+func (m GenreModel) Update(genre *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Two concurrent moves could each pass the cycle check below and still
+	// make a cycle together, so they take turns. Readers are not blocked.
+	_, err = tx.ExecContext(ctx, `LOCK TABLE genres IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+
+	if genre.ParentId != nil {
+		query := `
+			WITH RECURSIVE tree AS (
+				SELECT id FROM genres WHERE id = $1
+				UNION
+				SELECT c.id FROM genres c INNER JOIN tree t ON c.parent_id = t.id
+			)
+			SELECT EXISTS (SELECT 1 FROM tree WHERE id = $2)
+		`
+
+		var cycle bool
+
+		err = tx.QueryRowContext(ctx, query, genre.Id, *genre.ParentId).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+
+		if cycle {
+			return ErrGenreCycle
+		}
+	}
+
+	query := `
+		UPDATE genres
+		SET name = $1, parent_id = $2
+		WHERE id = $3
+	`
+
+	result, err := tx.ExecContext(ctx, query, genre.Name, genre.ParentId, genre.Id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "genres" violates foreign key constraint "genres_parent_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// OIDCState is the server side half of an authorization request that is in
+// flight with an external identity provider.
+type OIDCState struct {
+	State    string
+	Provider string
+	Verifier string
+	Nonce    string
+	Expiry   time.Time
+}
+
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+func (m IdentityModel) InsertState(state *OIDCState) error {
+	hash := sha256.Sum256([]byte(state.State))
+
+	query := `
+		INSERT INTO oidc_states (hash, provider, verifier, nonce, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	args := []interface{}{hash[:], state.Provider, state.Verifier, state.Nonce, state.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ConsumeState deletes and returns the state, so every state can complete
+// only one login.
+func (m IdentityModel) ConsumeState(provider, state string) (*OIDCState, error) {
+	hash := sha256.Sum256([]byte(state))
+
+	query := `
+		DELETE FROM oidc_states
+		WHERE hash = $1 AND provider = $2 AND expiry > $3
+		RETURNING provider, verifier, nonce, expiry
+	`
+
+	s := OIDCState{State: state}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:], provider, time.Now()).Scan(&s.Provider, &s.Verifier, &s.Nonce, &s.Expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+func (m IdentityModel) GetUser(provider, subject string) (*User, error) {
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated,
+			users.suspended_at, users.suspension_reason, users.suspended_until, users.version
+		FROM users
+		INNER JOIN user_identities ON user_identities.user_id = users.id
+		WHERE user_identities.provider = $1 AND user_identities.subject = $2
+		AND users.deleted_at IS NULL
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.Id,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.SuspendedAt,
+		&user.SuspensionReason,
+		&user.SuspendedUntil,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m IdentityModel) Link(provider, subject string, userID int64) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, provider, subject, userID)
+	return err
+}
@@ -0,0 +1,456 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/validator"
+	"github.com/lib/pq"
+)
+
+// LibraryGame is a game as it appears in a user's library, together with
+// what the user did with it.
+type LibraryGame struct {
+	Game
+	PurchasedAt     time.Time  `json:"purchasedAt"`
+	PlaytimeSeconds int64      `json:"playtimeSeconds"`
+	LastPlayedAt    *time.Time `json:"lastPlayedAt,omitempty"`
+	Favorite        bool       `json:"favorite"`
+	Hidden          bool       `json:"hidden"`
+	// The family member whose copy this is, for games the user doesn't own.
+	SharedBy *PublicUser `json:"sharedBy,omitempty"`
+}
+
+var LibraryGameFields = append(append([]string{}, GameFields...),
+	"purchasedAt", "playtimeSeconds", "lastPlayedAt", "favorite", "hidden", "sharedBy")
+
+// LibrarySearch narrows down the games listed from a library. Hidden games
+// are only listed when Hidden is set, and then only those.
+type LibrarySearch struct {
+	Title        string
+	Genres       []string
+	CollectionID int64
+	Favorite     *bool
+	Hidden       bool
+	Shared       *bool
+}
+
+var (
+	ErrOverlappingSession = errors.New("overlapping play session")
+	ErrAlreadyOwned       = errors.New("game already owned")
+)
+
+type PlaySession struct {
+	Id              int64     `json:"id"`
+	UserID          int64     `json:"-"`
+	GameID          int64     `json:"gameId"`
+	StartedAt       time.Time `json:"startedAt"`
+	EndedAt         time.Time `json:"endedAt"`
+	DurationSeconds int64     `json:"durationSeconds"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// MaxPlaySession bounds a single reported session, so a client with a broken
+// clock can't add days of playtime at once.
+const MaxPlaySession = 24 * time.Hour
+
+func ValidatePlaySession(v *validator.Validator, session *PlaySession) {
+	v.Check(!session.StartedAt.IsZero(), "startedAt", "must be provided")
+	v.Check(!session.EndedAt.IsZero(), "endedAt", "must be provided")
+
+	if !v.Valid() {
+		return
+	}
+
+	length := session.EndedAt.Sub(session.StartedAt)
+
+	v.Check(length > 0, "endedAt", "must be after startedAt")
+	v.Check(length <= MaxPlaySession, "endedAt", "session must not be longer than 24 hours")
+	v.Check(session.EndedAt.Before(time.Now().Add(5*time.Minute)), "endedAt", "must not be in the future")
+	v.Check(session.DurationSeconds > 0, "duration", "must be greater than zero")
+	v.Check(session.DurationSeconds <= int64(length/time.Second), "duration", "must not be longer than the session")
+}
+
+type LibraryModel struct {
+	DB *sql.DB
+}
+
+func (m LibraryModel) GetAll(userID int64, search LibrarySearch, filters Filters) ([]*LibraryGame, Metadata, error) {
+	// Games owned by other family members are listed too, unless the user
+	// owns them as well.
+	query := fmt.Sprintf(`
+		WITH RECURSIVE `+genreTree("$3")+`,
+		entries AS (
+			SELECT l.game_id, l.created_at, l.playtime_seconds, l.last_played_at, l.favorite, l.hidden,
+				NULL::bigint AS shared_by
+			FROM library l
+			WHERE l.user_id = $1
+			UNION ALL
+			(
+				SELECT DISTINCT ON (l.game_id) l.game_id, l.created_at, 0, NULL, false, false, l.user_id
+				FROM library l
+				INNER JOIN family_members fm ON fm.user_id = l.user_id
+				INNER JOIN family_members me ON me.family_id = fm.family_id AND me.user_id = $1
+				WHERE l.user_id <> $1
+				AND NOT EXISTS (SELECT 1 FROM library o WHERE o.user_id = $1 AND o.game_id = l.game_id)
+				ORDER BY l.game_id, l.created_at
+			)
+		)
+		SELECT count(*) OVER(), `+gameColumns+`,
+			e.created_at AS purchased_at, e.playtime_seconds AS playtime, e.last_played_at AS last_played,
+			e.favorite, e.hidden, u.id, u.name
+		FROM entries e
+		INNER JOIN games g ON g.id = e.game_id
+		LEFT JOIN users u ON u.id = e.shared_by
+		WHERE (to_tsvector('simple', g.title) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND `+genreFilter("$3", "g.genres")+`
+		AND ($4 = 0 OR EXISTS (
+			SELECT 1 FROM collection_games cg
+			WHERE cg.collection_id = $4 AND cg.game_id = e.game_id
+		))
+		AND (e.favorite = $5 OR $5 IS NULL)
+		AND e.hidden = $6
+		AND ((e.shared_by IS NOT NULL) = $7 OR $7 IS NULL)
+		ORDER BY %s %s NULLS LAST, g.id ASC
+		LIMIT $8 OFFSET $9
+	`, filters.sortColumn(), filters.sortDirection())
+
+	args := []interface{}{
+		userID,
+		search.Title,
+		pq.Array(search.Genres),
+		search.CollectionID,
+		search.Favorite,
+		search.Hidden,
+		search.Shared,
+		filters.limit(),
+		filters.offset(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	games := []*LibraryGame{}
+
+	for rows.Next() {
+		var game LibraryGame
+		var sharedByID sql.NullInt64
+		var sharedByName sql.NullString
+		dest := append([]interface{}{&totalRecords}, game.scanDest()...)
+		dest = append(dest,
+			&game.PurchasedAt,
+			&game.PlaytimeSeconds,
+			&game.LastPlayedAt,
+			&game.Favorite,
+			&game.Hidden,
+			&sharedByID,
+			&sharedByName,
+		)
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		if sharedByID.Valid {
+			game.SharedBy = &PublicUser{Id: sharedByID.Int64, Name: sharedByName.String}
+		}
+		games = append(games, &game)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return games, metadata, nil
+}
+
+// SetFlags updates the favorite and hidden flags of a library entry. Nil
+// values are left unchanged.
+func (m LibraryModel) SetFlags(userID, gameID int64, favorite, hidden *bool) error {
+	query := `
+		UPDATE library
+		SET favorite = COALESCE($3, favorite), hidden = COALESCE($4, hidden)
+		WHERE user_id = $1 AND game_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, gameID, favorite, hidden)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AddSession records a play session and adds it to the totals of the
+// library entry. Sessions of a game borrowed from a family member are
+// recorded without totals, since the borrower has no library entry. It
+// returns ErrRecordNotFound if the user can't play the game, and ErrOverlappingSession if it overlaps a session already recorded
+// for the game, such as a retried report.
+func (m LibraryModel) AddSession(session *PlaySession) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Sessions may be reported out of order, so last_played_at only moves
+	// forward.
+	query := `
+		UPDATE library
+		SET playtime_seconds = playtime_seconds + $3, last_played_at = GREATEST(last_played_at, $4)
+		WHERE user_id = $1 AND game_id = $2
+	`
+	result, err := tx.ExecContext(ctx, query, session.UserID, session.GameID, session.DurationSeconds, session.EndedAt)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		var leased bool
+
+		query = `SELECT ` + playable
+		err = tx.QueryRowContext(ctx, query, session.UserID, session.GameID).Scan(&leased)
+		if err != nil {
+			return err
+		}
+
+		if !leased {
+			return ErrRecordNotFound
+		}
+	}
+
+	query = `
+		INSERT INTO play_sessions (user_id, game_id, started_at, ended_at, duration_seconds)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	args := []interface{}{session.UserID, session.GameID, session.StartedAt, session.EndedAt, session.DurationSeconds}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&session.Id, &session.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: conflicting key value violates exclusion constraint "play_sessions_no_overlap"`:
+			return ErrOverlappingSession
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m LibraryModel) GetSessionsForUser(userID int64) ([]*PlaySession, error) {
+	query := `
+		SELECT id, user_id, game_id, started_at, ended_at, duration_seconds, created_at
+		FROM play_sessions
+		WHERE user_id = $1
+		ORDER BY started_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*PlaySession{}
+
+	for rows.Next() {
+		var session PlaySession
+		err := rows.Scan(
+			&session.Id,
+			&session.UserID,
+			&session.GameID,
+			&session.StartedAt,
+			&session.EndedAt,
+			&session.DurationSeconds,
+			&session.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// playable holds when user $1 owns game $2 or has it checked out from a
+// family member.
+const playable = `(
+	EXISTS (SELECT 1 FROM library WHERE user_id = $1 AND game_id = $2)
+	OR EXISTS (SELECT 1 FROM game_leases WHERE borrower_id = $1 AND game_id = $2 AND expires_at > NOW())
+)`
+
+// CanPlay reports whether the user owns the game or holds an active lease
+// on a family member's copy.
+func (m LibraryModel) CanPlay(userID, gameID int64) (bool, error) {
+	query := `SELECT ` + playable
+
+	var ok bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, gameID).Scan(&ok)
+	return ok, err
+}
+
+func (m LibraryModel) Owns(userID, gameID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM library WHERE user_id = $1 AND game_id = $2
+		)
+	`
+
+	var owns bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, gameID).Scan(&owns)
+	return owns, err
+}
+
+// OwnedOf returns which of the games the user owns.
+func (m LibraryModel) OwnedOf(userID int64, gameIDs []int64) (map[int64]bool, error) {
+	query := `
+		SELECT game_id
+		FROM library
+		WHERE user_id = $1 AND game_id = ANY($2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(gameIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owned := make(map[int64]bool)
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		owned[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return owned, nil
+}
+
+// Purchase charges price to the user's wallet and adds the games to their
+// library, along with everything included in editions among them. Included
+// games the user already owns are skipped. It returns ErrAlreadyOwned if
+// the user owns one of the games bought, and ErrInsufficientFunds if the
+// wallet can't cover the price.
+func (m LibraryModel) Purchase(userID int64, gameIDs []int64, price float64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var balance float64
+
+	err = tx.QueryRowContext(ctx, `SELECT balance FROM wallet WHERE id = $1 FOR UPDATE`, userID).Scan(&balance)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	// The wallet lock serializes the user's purchases, so a concurrent
+	// purchase of the same game has committed by now and is seen here.
+	var owned bool
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM library WHERE user_id = $1 AND game_id = ANY($2)
+		)
+	`
+
+	err = tx.QueryRowContext(ctx, query, userID, pq.Array(gameIDs)).Scan(&owned)
+	if err != nil {
+		return err
+	}
+
+	if owned {
+		return ErrAlreadyOwned
+	}
+
+	if balance < price {
+		return ErrInsufficientFunds
+	}
+
+	query = `
+		INSERT INTO library (user_id, game_id)
+		SELECT $1, g.id
+		FROM games g
+		WHERE g.id = ANY($2) OR g.id IN (SELECT gi.included_id FROM game_includes gi WHERE gi.game_id = ANY($2))
+		ON CONFLICT (user_id, game_id) DO NOTHING
+	`
+
+	_, err = tx.ExecContext(ctx, query, userID, pq.Array(gameIDs))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE wallet SET balance = balance - $1 WHERE id = $2`, price, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
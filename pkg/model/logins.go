@@ -0,0 +1,124 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type LoginEvent struct {
+	Id        int64     `json:"id"`
+	UserID    *int64    `json:"-"`
+	Email     string    `json:"-"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginFailures describes the failed attempts made within the tracking
+// window.
+type LoginFailures struct {
+	Count       int
+	LastFailure time.Time
+}
+
+type LoginEventModel struct {
+	DB *sql.DB
+}
+
+func (m LoginEventModel) Insert(event *LoginEvent) error {
+	query := `
+		INSERT INTO login_events (user_id, email, ip, user_agent, success)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	args := []interface{}{event.UserID, event.Email, event.IP, event.UserAgent, event.Success}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&event.Id, &event.CreatedAt)
+}
+
+// FailuresForEmail counts the failed logins as email since its last
+// successful login.
+func (m LoginEventModel) FailuresForEmail(email string, since time.Time) (LoginFailures, error) {
+	query := `
+		SELECT count(*), max(created_at)
+		FROM login_events
+		WHERE email = $1 AND success = false AND created_at > $2
+		AND created_at > COALESCE(
+			(SELECT max(created_at) FROM login_events WHERE email = $1 AND success = true),
+			'-infinity'
+		)
+	`
+
+	return m.failures(query, email, since)
+}
+
+// FailuresForIP counts every failed login from the address. Successful
+// logins don't reset it, or an attacker could log into an account of their
+// own between guesses.
+func (m LoginEventModel) FailuresForIP(ip string, since time.Time) (LoginFailures, error) {
+	query := `
+		SELECT count(*), max(created_at)
+		FROM login_events
+		WHERE ip = $1 AND success = false AND created_at > $2
+	`
+
+	return m.failures(query, ip, since)
+}
+
+func (m LoginEventModel) failures(query, value string, since time.Time) (LoginFailures, error) {
+	var failures LoginFailures
+	var last sql.NullTime
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, value, since).Scan(&failures.Count, &last)
+	if err != nil {
+		return LoginFailures{}, err
+	}
+	failures.LastFailure = last.Time
+
+	return failures, nil
+}
+
+func (m LoginEventModel) GetRecentForUser(userID int64, limit int) ([]*LoginEvent, error) {
+	query := `
+		SELECT id, ip, user_agent, success, created_at
+		FROM login_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*LoginEvent{}
+
+	for rows.Next() {
+		var event LoginEvent
+		err := rows.Scan(&event.Id, &event.IP, &event.UserAgent, &event.Success, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -18,6 +18,20 @@ type Models struct {
 	Games      GameModel
 	Users      UserModel
 	Tokens     TokenModel
+	APIKeys    APIKeyModel
+	TwoFactor  TwoFactorModel
+	Logins     LoginEventModel
+	Identities IdentityModel
+	Exports    DataExportModel
+	Friends    FriendModel
+	Library    LibraryModel
+	Achievements AchievementModel
+	Collections CollectionModel
+	Families   FamilyModel
+	Genres     GenreModel
+	Tags       TagModel
+	Bundles    BundleModel
+	Preorders  PreorderModel
 }
 
 func NewModels(db *sql.DB) Models {
@@ -41,5 +55,19 @@ func NewModels(db *sql.DB) Models {
 			DB: db,
 		},
 		Permissions: PermissionModel{DB: db},
+		APIKeys:     APIKeyModel{DB: db},
+		TwoFactor:   TwoFactorModel{DB: db},
+		Logins:      LoginEventModel{DB: db},
+		Identities:  IdentityModel{DB: db},
+		Exports:     DataExportModel{DB: db},
+		Friends:     FriendModel{DB: db},
+		Library:     LibraryModel{DB: db},
+		Achievements: AchievementModel{DB: db},
+		Collections: CollectionModel{DB: db},
+		Families:    FamilyModel{DB: db},
+		Genres:      GenreModel{DB: db},
+		Tags:        TagModel{DB: db},
+		Bundles:     BundleModel{DB: db},
+		Preorders:   PreorderModel{DB: db},
 	}
 }
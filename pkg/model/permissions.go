@@ -19,6 +19,16 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
+func (p Permissions) Intersect(other Permissions) Permissions {
+	result := Permissions{}
+	for _, code := range p {
+		if other.Include(code) {
+			result = append(result, code)
+		}
+	}
+	return result
+}
+
 type PermissionModel struct {
 	DB *sql.DB
 }
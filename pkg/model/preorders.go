@@ -0,0 +1,302 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicatePreorder = errors.New("duplicate preorder")
+	ErrAlreadyReleased   = errors.New("game already released")
+)
+
+const (
+	PreorderPending   = "pending"
+	PreorderFulfilled = "fulfilled"
+	PreorderCancelled = "cancelled"
+)
+
+// Preorder is a paid entitlement to a game that isn't out yet. It stays
+// pending until the release date passes and the game is added to the
+// library, or until the user cancels it for a refund.
+type Preorder struct {
+	Id          int64      `json:"id"`
+	UserId      int64      `json:"-"`
+	GameId      int64      `json:"gameId"`
+	Title       string     `json:"title"`
+	ReleaseDate time.Time  `json:"releaseDate"`
+	Price       float64    `json:"price"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ClosedAt    *time.Time `json:"closedAt,omitempty"`
+}
+
+type PreorderModel struct {
+	DB *sql.DB
+}
+
+// Insert charges the price to the user's wallet and records the pre-order.
+// It returns ErrInsufficientFunds if the wallet can't cover the price.
+func (m PreorderModel) Insert(preorder *Preorder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var balance float64
+
+	err = tx.QueryRowContext(ctx, `SELECT balance FROM wallet WHERE id = $1 FOR UPDATE`, preorder.UserId).Scan(&balance)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if balance < preorder.Price {
+		return ErrInsufficientFunds
+	}
+
+	query := `
+		INSERT INTO preorders (user_id, game_id, price)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, created_at
+	`
+
+	err = tx.QueryRowContext(ctx, query, preorder.UserId, preorder.GameId, preorder.Price).Scan(&preorder.Id, &preorder.Status, &preorder.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "preorders_pending_idx"`:
+			return ErrDuplicatePreorder
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE wallet SET balance = balance - $1 WHERE id = $2`, preorder.Price, preorder.UserId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAllForUser lists the user's pre-orders, pending ones first.
+func (m PreorderModel) GetAllForUser(userID int64) ([]*Preorder, error) {
+	query := `
+		SELECT p.id, p.user_id, p.game_id, g.title, g.release_date, p.price, p.status, p.created_at, p.closed_at
+		FROM preorders p
+		INNER JOIN games g ON g.id = p.game_id
+		WHERE p.user_id = $1
+		ORDER BY p.status <> 'pending', g.release_date, p.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	preorders := []*Preorder{}
+
+	for rows.Next() {
+		var preorder Preorder
+
+		err := rows.Scan(
+			&preorder.Id,
+			&preorder.UserId,
+			&preorder.GameId,
+			&preorder.Title,
+			&preorder.ReleaseDate,
+			&preorder.Price,
+			&preorder.Status,
+			&preorder.CreatedAt,
+			&preorder.ClosedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		preorders = append(preorders, &preorder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return preorders, nil
+}
+
+// HasPending reports whether the user has a pending pre-order for the game.
+func (m PreorderModel) HasPending(userID, gameID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM preorders WHERE user_id = $1 AND game_id = $2 AND status = 'pending'
+		)
+	`
+
+	var pending bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, gameID).Scan(&pending)
+	return pending, err
+}
+
+// Cancel cancels a pending pre-order and refunds its price. Pre-orders can
+// only be cancelled before the game's release date.
+func (m PreorderModel) Cancel(id, userID int64) (*Preorder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT p.id, p.user_id, p.game_id, g.title, g.release_date, p.price, p.status, p.created_at
+		FROM preorders p
+		INNER JOIN games g ON g.id = p.game_id
+		WHERE p.id = $1 AND p.user_id = $2 AND p.status = 'pending'
+		FOR UPDATE OF p
+	`
+
+	var preorder Preorder
+
+	err = tx.QueryRowContext(ctx, query, id, userID).Scan(
+		&preorder.Id,
+		&preorder.UserId,
+		&preorder.GameId,
+		&preorder.Title,
+		&preorder.ReleaseDate,
+		&preorder.Price,
+		&preorder.Status,
+		&preorder.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if !preorder.ReleaseDate.After(time.Now()) {
+		return nil, ErrAlreadyReleased
+	}
+
+	query = `
+		UPDATE preorders
+		SET status = 'cancelled', closed_at = NOW()
+		WHERE id = $1
+		RETURNING status, closed_at
+	`
+
+	err = tx.QueryRowContext(ctx, query, preorder.Id).Scan(&preorder.Status, &preorder.ClosedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE wallet SET balance = balance + $1 WHERE id = $2`, preorder.Price, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &preorder, nil
+}
+
+// FulfillReleased marks announced and pre-order games whose release date has
+// passed as released and moves their pending pre-orders into the buyers' libraries,
+// along with everything included in editions.
+func (m PreorderModel) FulfillReleased() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE games
+		SET status = 'released', version = version + 1
+		WHERE status IN ('announced', 'pre-order') AND release_date <= $1
+	`
+
+	_, err = tx.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE preorders p
+		SET status = 'fulfilled', closed_at = NOW()
+		FROM games g
+		WHERE g.id = p.game_id AND p.status = 'pending' AND g.release_date <= $1
+		RETURNING p.user_id, p.game_id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var userIDs, gameIDs []int64
+
+	for rows.Next() {
+		var userID, gameID int64
+		if err := rows.Scan(&userID, &gameID); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, userID)
+		gameIDs = append(gameIDs, gameID)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(userIDs) == 0 {
+		return tx.Commit()
+	}
+
+	query = `
+		INSERT INTO library (user_id, game_id)
+		SELECT DISTINCT f.user_id, g.id
+		FROM unnest($1::bigint[], $2::bigint[]) AS f (user_id, game_id)
+		INNER JOIN games g ON g.id = f.game_id
+			OR g.id IN (SELECT gi.included_id FROM game_includes gi WHERE gi.game_id = f.game_id)
+		ON CONFLICT (user_id, game_id) DO NOTHING
+	`
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(userIDs), pq.Array(gameIDs))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
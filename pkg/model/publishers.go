@@ -6,6 +6,8 @@ import (
 	// "errors"
 	"log"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Publisher struct {
@@ -69,3 +71,38 @@ func (m PublisherModel) GetAll() ([]Publisher, error) {
 	}
 	return pubs, nil
 }
+
+// GetByIDs returns the publishers with the given ids, keyed by id.
+func (m PublisherModel) GetByIDs(ids []int64) (map[string]*Publisher, error) {
+	query := `
+		SELECT id, name, headquarters, website
+		FROM publishers
+		WHERE id = ANY($1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pubs := make(map[string]*Publisher)
+
+	for rows.Next() {
+		var pub Publisher
+		err := rows.Scan(&pub.Id, &pub.Name, &pub.Headquarters, &pub.Website)
+		if err != nil {
+			return nil, err
+		}
+		pubs[pub.Id] = &pub
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pubs, nil
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type GameSuggestion struct {
+	Id    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type PublisherSuggestion struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type GenreSuggestion struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type Suggestions struct {
+	Games      []GameSuggestion      `json:"games"`
+	Publishers []PublisherSuggestion `json:"publishers"`
+	Genres     []GenreSuggestion     `json:"genres"`
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Suggest returns up to limit games, publishers and genres for a search box.
+// Names starting with q come first, then close trigram matches, which also
+// catch typos. Popularity, the number of owners, breaks ties between
+// similar matches. It is read from suggest_popularity, so ranking a
+// candidate is an index lookup instead of a count. Delisted games, and
+// publishers with nothing but delisted games, are left out.
+func (m GameModel) Suggest(q string, limit int) (*Suggestions, error) {
+	prefix := likeEscaper.Replace(q) + "%"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	suggestions := &Suggestions{
+		Games:      []GameSuggestion{},
+		Publishers: []PublisherSuggestion{},
+		Genres:     []GenreSuggestion{},
+	}
+
+	query := `
+		SELECT g.id, g.title
+		FROM games g
+		WHERE (g.title ILIKE $2 OR $1 <% g.title) AND g.status <> 'delisted'
+		ORDER BY (g.title ILIKE $2)::int + word_similarity($1, g.title)
+			+ 0.1 * ln(1 + COALESCE((
+				SELECT sp.popularity FROM suggest_popularity sp WHERE sp.kind = 'game' AND sp.key = g.id::text
+			), 0)) DESC, g.id
+		LIMIT $3
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, q, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var game GameSuggestion
+		if err := rows.Scan(&game.Id, &game.Title); err != nil {
+			return nil, err
+		}
+		suggestions.Games = append(suggestions.Games, game)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT p.id, p.name
+		FROM publishers p
+		WHERE (p.name ILIKE $2 OR $1 <% p.name)
+			AND EXISTS (SELECT 1 FROM games g WHERE g.publisher_id = p.id AND g.status <> 'delisted')
+		ORDER BY (p.name ILIKE $2)::int + word_similarity($1, p.name)
+			+ 0.1 * ln(1 + COALESCE((
+				SELECT sp.popularity FROM suggest_popularity sp WHERE sp.kind = 'publisher' AND sp.key = p.id::text
+			), 0)) DESC, p.id
+		LIMIT $3
+	`
+
+	rows, err = m.DB.QueryContext(ctx, query, q, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var publisher PublisherSuggestion
+		if err := rows.Scan(&publisher.Id, &publisher.Name); err != nil {
+			return nil, err
+		}
+		suggestions.Publishers = append(suggestions.Publishers, publisher)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT gn.slug, gn.name
+		FROM genres gn
+		WHERE gn.name ILIKE $2 OR gn.slug ILIKE $2 OR $1 <% gn.name
+		ORDER BY (gn.name ILIKE $2 OR gn.slug ILIKE $2)::int + word_similarity($1, gn.name)
+			+ 0.1 * ln(1 + COALESCE((
+				SELECT sp.popularity FROM suggest_popularity sp WHERE sp.kind = 'genre' AND sp.key = gn.slug
+			), 0)) DESC, gn.slug
+		LIMIT $3
+	`
+
+	rows, err = m.DB.QueryContext(ctx, query, q, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var genre GenreSuggestion
+		if err := rows.Scan(&genre.Slug, &genre.Name); err != nil {
+			return nil, err
+		}
+		suggestions.Genres = append(suggestions.Genres, genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// RefreshPopularity recounts the popularity that ranks search suggestions.
+// Readers see the old counts until it is done.
+func (m GameModel) RefreshPopularity() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY suggest_popularity`)
+	return err
+}
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ermapula/golang-project/pkg/validator"
+)
+
+// Tag is a user-generated label on a game. Count is how many users applied
+// it to the game.
+type Tag struct {
+	Id      int64  `json:"id"`
+	Slug    string `json:"slug"`
+	Name    string `json:"name"`
+	Count   int    `json:"count"`
+	Applied bool   `json:"applied"`
+}
+
+func ValidateTag(v *validator.Validator, tag *Tag) {
+	v.Check(tag.Name != "", "name", "must be provided")
+	v.Check(len(tag.Name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(tag.Slug != "", "name", "must contain letters or digits")
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+// GetAllForGame returns a game's tags, most applied first. Applied tells
+// whether the user applied the tag themselves.
+func (m TagModel) GetAllForGame(gameID, userID int64) ([]*Tag, error) {
+	query := `
+		SELECT t.id, t.slug, t.name, count(*), bool_or(gt.user_id = $2)
+		FROM game_tags gt
+		INNER JOIN tags t ON t.id = gt.tag_id
+		WHERE gt.game_id = $1
+		GROUP BY t.id
+		ORDER BY count(*) DESC, t.slug
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, gameID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+
+	for rows.Next() {
+		var tag Tag
+		err := rows.Scan(&tag.Id, &tag.Slug, &tag.Name, &tag.Count, &tag.Applied)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// Apply tags a game for the user, creating the tag the first time its slug
+// is used. Applying a tag twice is not an error.
+func (m TagModel) Apply(gameID, userID int64, tag *Tag) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO tags (slug, name)
+		VALUES ($1, $2)
+		ON CONFLICT (slug) DO UPDATE SET slug = EXCLUDED.slug
+		RETURNING id, name
+	`
+
+	err = tx.QueryRowContext(ctx, query, tag.Slug, tag.Name).Scan(&tag.Id, &tag.Name)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO game_tags (game_id, tag_id, user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err = tx.ExecContext(ctx, query, gameID, tag.Id, userID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "game_tags" violates foreign key constraint "game_tags_game_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m TagModel) Remove(gameID, userID, tagID int64) error {
+	query := `
+		DELETE FROM game_tags
+		WHERE game_id = $1 AND user_id = $2 AND tag_id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, gameID, userID, tagID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
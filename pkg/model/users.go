@@ -2,9 +2,12 @@ package model
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -14,10 +17,19 @@ import (
 
 var (
 	ErrDuplicateEmail = errors.New("duplicate email")
+	ErrInsufficientFunds = errors.New("insufficient funds")
 )
 
 var AnonymousUser = &User{}
 
+const (
+	PrivacyPublic  = "public"
+	PrivacyFriends = "friends"
+	PrivacyPrivate = "private"
+)
+
+var PrivacySafelist = []string{PrivacyPublic, PrivacyFriends, PrivacyPrivate}
+
 type User struct {
 	Id int64 `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
@@ -25,13 +37,39 @@ type User struct {
 	Email string `json:"email"`
 	Password password `json:"-"`
 	Activated bool `json:"activated"`
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+	SuspensionReason string `json:"suspension_reason,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	LibraryPrivacy string `json:"library_privacy,omitempty"`
 	Version int `json:"-"`
+	// JWTs issued for an older generation are no longer accepted.
+	TokenGeneration int `json:"-"`
+}
+
+// Profile is the public view of a user. The library is only filled in when
+// the user's privacy setting lets the viewer see it.
+type Profile struct {
+	PublicUser
+	JoinedAt  time.Time `json:"joined_at"`
+	Privacy   string    `json:"privacy"`
+	GameCount *int      `json:"game_count,omitempty"`
+	Library   []*Game   `json:"library,omitempty"`
 }
 
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// IsSuspended reports whether the user is currently suspended. A suspension
+// without an end date is a ban.
+func (u *User) IsSuspended() bool {
+	if u.SuspendedAt == nil {
+		return false
+	}
+
+	return u.SuspendedUntil == nil || time.Now().Before(*u.SuspendedUntil)
+}
+
 type password struct {
 	plaintext *string
 	hash []byte
@@ -49,6 +87,19 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// SetUnusable replaces the password with a random one nobody knows, for
+// accounts that must not be able to log in with a password.
+func (p *password) SetUnusable() error {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	return p.Set(base64.RawURLEncoding.EncodeToString(randomBytes))
+}
+
 func (p *password) Matches(plaintextPassword string) (bool, error) {
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
@@ -79,6 +130,10 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
 }
 
+func ValidatePrivacy(v *validator.Validator, key, privacy string) {
+	v.Check(validator.In(privacy, PrivacySafelist...), key, "must be one of public, friends or private")
+}
+
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Name != "", "name", "must be provided")
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
@@ -134,9 +189,10 @@ func (m UserModel) Insert(user *User) error {
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, suspended_at, suspension_reason, suspended_until, version,
+			token_generation
 		FROM users
-		WHERE email = $1
+		WHERE email = $1 AND deleted_at IS NULL
 	`
 	var user User
 
@@ -150,7 +206,50 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.SuspendedAt,
+		&user.SuspensionReason,
+		&user.SuspendedUntil,
 		&user.Version,
+		&user.TokenGeneration,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) Get(id int64) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, suspended_at, suspension_reason, suspended_until, library_privacy, version,
+			token_generation
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.Id,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.SuspendedAt,
+		&user.SuspensionReason,
+		&user.SuspendedUntil,
+		&user.LibraryPrivacy,
+		&user.Version,
+		&user.TokenGeneration,
 	)
 
 	if err != nil {
@@ -204,13 +303,16 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version 
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated,
+			users.suspended_at, users.suspension_reason, users.suspended_until, users.version,
+			users.token_generation
 		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
 		WHERE tokens.hash = $1
 		AND tokens.scope = $2
 		AND tokens.expirt > $3
+		AND users.deleted_at IS NULL
 	`
 
 	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
@@ -226,7 +328,11 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.SuspendedAt,
+		&user.SuspensionReason,
+		&user.SuspendedUntil,
 		&user.Version,
+		&user.TokenGeneration,
 	)
 	if err != nil {
 		switch {
@@ -240,6 +346,337 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	return &user, nil
 }
 
+// SoftDelete anonymizes the user and revokes every credential they hold.
+// The row itself is kept so library and wallet records stay intact.
+func (m UserModel) SoftDelete(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET name = 'Deleted user', email = 'deleted-' || id || '@users.invalid', password_hash = $1,
+			activated = false, deleted_at = NOW(), version = version + 1, token_generation = token_generation + 1
+		WHERE id = $2 AND version = $3 AND deleted_at IS NULL
+	`
+
+	// An empty hash never matches any password.
+	result, err := tx.ExecContext(ctx, query, []byte{}, user.Id, user.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	for _, table := range []string{"tokens", "api_keys", "two_factor", "recovery_codes", "user_identities", "login_events", "family_members", "family_invites", "collections", "data_exports"} {
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, user.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM friend_requests WHERE requester_id = $1 OR addressee_id = $1`, user.Id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM blocks WHERE blocker_id = $1 OR blocked_id = $1`, user.Id)
+	if err != nil {
+		return err
+	}
+
+	// A deleted user's games are no longer shared with their family, and a
+	// family goes away with its owner.
+	_, err = tx.ExecContext(ctx, `DELETE FROM game_leases WHERE lender_id = $1 OR borrower_id = $1`, user.Id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM families WHERE owner_id = $1`, user.Id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateProfile saves the fields users edit themselves, along with the
+// activation flag, in a single statement. The user must have been loaded
+// with Get, the only query that reads library_privacy.
+func (m UserModel) UpdateProfile(user *User) error {
+	query := `
+		UPDATE users
+		SET name = $1, email = $2, activated = $3, library_privacy = $4, version = version + 1
+		WHERE id = $5 AND version = $6 AND deleted_at IS NULL
+		RETURNING version
+	`
+
+	args := []interface{}{
+		user.Name,
+		user.Email,
+		user.Activated,
+		user.LibraryPrivacy,
+		user.Id,
+		user.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m UserModel) GetAll(search string, activated, suspended *bool, role string, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, email, activated, suspended_at, suspension_reason, suspended_until, version
+		FROM users
+		WHERE deleted_at IS NULL
+		AND (name ILIKE '%%' || $1 || '%%' OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+		AND (activated = $2 OR $2 IS NULL)
+		AND ((suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > NOW())) = $3 OR $3 IS NULL)
+		AND ($4 = '' OR EXISTS (
+			SELECT 1
+			FROM users_permissions
+			INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+			WHERE users_permissions.user_id = users.id AND permissions.code = $4
+		))
+		ORDER BY %s %s, id ASC
+		LIMIT $5 OFFSET $6
+	`, filters.sortColumn(), filters.sortDirection())
+
+	args := []interface{}{search, activated, suspended, role, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&totalRecords,
+			&user.Id,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.SuspendedAt,
+			&user.SuspensionReason,
+			&user.SuspendedUntil,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
+// Suspend suspends the user until the given time, or for good if until is
+// nil, and revokes all of their tokens and JWTs.
+func (m UserModel) Suspend(id int64, reason string, until *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET suspended_at = NOW(), suspension_reason = $1, suspended_until = $2, version = version + 1,
+			token_generation = token_generation + 1
+		WHERE id = $3 AND deleted_at IS NULL
+	`
+
+	result, err := tx.ExecContext(ctx, query, reason, until, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeCredentials signs the user out everywhere: it deletes their
+// authentication and password reset tokens and API keys, and revokes every
+// JWT issued to them so far.
+func (m UserModel) RevokeCredentials(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET token_generation = token_generation + 1
+		WHERE id = $1
+	`
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	query = `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope IN ($2, $3)
+	`
+
+	_, err = tx.ExecContext(ctx, query, id, ScopeAuthentication, ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM api_keys WHERE user_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeJWTs revokes every JWT issued to the user so far without touching
+// their opaque tokens. The user's TokenGeneration is updated so a fresh JWT
+// can be issued right away.
+func (m UserModel) RevokeJWTs(user *User) error {
+	query := `
+		UPDATE users
+		SET token_generation = token_generation + 1
+		WHERE id = $1
+		RETURNING token_generation
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, user.Id).Scan(&user.TokenGeneration)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m UserModel) Unsuspend(id int64) error {
+	query := `
+		UPDATE users
+		SET suspended_at = NULL, suspension_reason = '', suspended_until = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	return m.execForUser(query, id)
+}
+
+// LiftExpiredSuspensions clears suspensions whose end date has passed.
+// IsSuspended already ignores them, this just keeps the table tidy.
+func (m UserModel) LiftExpiredSuspensions() error {
+	query := `
+		UPDATE users
+		SET suspended_at = NULL, suspension_reason = '', suspended_until = NULL, version = version + 1
+		WHERE suspended_until <= $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now())
+	return err
+}
+
+func (m UserModel) execForUser(query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
 type Wallet struct {
 	Id int64 `json:"id"`
 	Balance float64 `json:"balance"`
@@ -293,3 +730,109 @@ func (m UserModel) UpdateWallet(userId int64, amount float64) (*Wallet, error) {
 
 	return &wallet, nil
 }
+
+type WalletAdjustment struct {
+	Id        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	AdminID   int64     `json:"admin_id"`
+	Amount    float64   `json:"amount"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetWalletAdjustments returns the adjustments admins made to the user's
+// wallet, oldest first. AdminID is zero once the admin has been deleted.
+func (m UserModel) GetWalletAdjustments(userID int64) ([]*WalletAdjustment, error) {
+	query := `
+		SELECT id, user_id, COALESCE(admin_id, 0), amount, reason, created_at
+		FROM wallet_adjustments
+		WHERE user_id = $1
+		ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	adjustments := []*WalletAdjustment{}
+
+	for rows.Next() {
+		var adjustment WalletAdjustment
+		err := rows.Scan(
+			&adjustment.Id,
+			&adjustment.UserID,
+			&adjustment.AdminID,
+			&adjustment.Amount,
+			&adjustment.Reason,
+			&adjustment.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		adjustments = append(adjustments, &adjustment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return adjustments, nil
+}
+
+func ValidateWalletAdjustment(v *validator.Validator, adjustment *WalletAdjustment) {
+	v.Check(adjustment.Amount != 0, "amount", "must not be zero")
+	v.Check(adjustment.Reason != "", "reason", "must be provided")
+	v.Check(len(adjustment.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+}
+
+// AdjustWallet changes the balance and records who did it and why. The
+// balance is never allowed to drop below zero.
+func (m UserModel) AdjustWallet(adjustment *WalletAdjustment) (*Wallet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE wallet
+		SET balance = balance + $1
+		WHERE id = $2 AND balance + $1 >= 0
+		RETURNING id, balance
+	`
+
+	var wallet Wallet
+
+	err = tx.QueryRowContext(ctx, query, adjustment.Amount, adjustment.UserID).Scan(&wallet.Id, &wallet.Balance)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrInsufficientFunds
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		INSERT INTO wallet_adjustments (user_id, admin_id, amount, reason)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	args := []interface{}{adjustment.UserID, adjustment.AdminID, adjustment.Amount, adjustment.Reason}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&adjustment.Id, &adjustment.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wallet, tx.Commit()
+}
@@ -0,0 +1,324 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockProvider is a minimal OpenID Connect provider: it redirects every
+// authorization request straight back with a code and checks the PKCE
+// verifier when the code is exchanged.
+type mockProvider struct {
+	*httptest.Server
+
+	key *rsa.PrivateKey
+	kid string
+
+	// tweak changes the claims of issued id tokens.
+	tweak func(claims map[string]interface{})
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+type grant struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockProvider{key: key, kid: "mock-key", codes: make(map[string]grant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/authorize", m.authorize)
+	mux.HandleFunc("/token", m.token)
+	mux.HandleFunc("/jwks", m.jwks)
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+func (m *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 m.URL,
+		"authorization_endpoint": m.URL + "/authorize",
+		"token_endpoint":         m.URL + "/token",
+		"jwks_uri":               m.URL + "/jwks",
+	})
+}
+
+func (m *mockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	if qs.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE required", http.StatusBadRequest)
+		return
+	}
+
+	code, _ := RandomString()
+
+	m.mu.Lock()
+	m.codes[code] = grant{
+		challenge:   qs.Get("code_challenge"),
+		nonce:       qs.Get("nonce"),
+		redirectURI: qs.Get("redirect_uri"),
+	}
+	m.mu.Unlock()
+
+	callback := qs.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {qs.Get("state")}}.Encode()
+	http.Redirect(w, r, callback, http.StatusFound)
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != "client" || secret != "secret" {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+
+	m.mu.Lock()
+	g, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	if !ok || Challenge(r.PostForm.Get("code_verifier")) != g.challenge || r.PostForm.Get("redirect_uri") != g.redirectURI {
+		http.Error(w, "invalid grant", http.StatusBadRequest)
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":            m.URL,
+		"sub":            "user-1",
+		"aud":            "client",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          g.nonce,
+		"email":          "gamer@example.com",
+		"email_verified": true,
+		"name":           "Gamer",
+	}
+	if m.tweak != nil {
+		m.tweak(claims)
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(claims)})
+}
+
+func (m *mockProvider) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": m.kid})
+	payload, _ := json.Marshal(claims)
+
+	signingInput := encoding.EncodeToString(header) + "." + encoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signingInput + "." + encoding.EncodeToString(signature)
+}
+
+func (m *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock-key",
+			"use": "sig",
+			"n":   encoding.EncodeToString(m.key.N.Bytes()),
+			"e":   encoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+// login runs the browser side of the flow: it follows the authorization URL
+// and returns the code and state the provider sent back to the callback.
+func login(t *testing.T, p *Provider, state, nonce, verifier string) (code, returnedState string) {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %s", res.Status)
+	}
+
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := callback.Scheme + "://" + callback.Host + callback.Path; got != p.RedirectURL {
+		t.Fatalf("redirected to %q, want %q", got, p.RedirectURL)
+	}
+
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestLoginCallback(t *testing.T) {
+	tests := []struct {
+		name          string
+		tweak         func(claims map[string]interface{})
+		wrongVerifier bool
+		wrongNonce    bool
+		unknownKey    bool
+		wantErr       error
+		wantAnyErr    bool
+	}{
+		{name: "valid"},
+		{name: "wrong verifier", wrongVerifier: true, wantAnyErr: true},
+		{name: "wrong nonce", wrongNonce: true, wantErr: ErrInvalidIDToken},
+		{name: "unknown key", unknownKey: true, wantErr: ErrUnknownKey},
+		{
+			name:    "other audience",
+			tweak:   func(c map[string]interface{}) { c["aud"] = []string{"someone-else"} },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "other issuer",
+			tweak:   func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "expired",
+			tweak:   func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "missing subject",
+			tweak:   func(c map[string]interface{}) { delete(c, "sub") },
+			wantErr: ErrInvalidIDToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockProvider(t)
+			mock.tweak = tt.tweak
+			if tt.unknownKey {
+				mock.kid = "rotated-away"
+			}
+
+			p := NewProvider(Config{
+				Name:         "mock",
+				Issuer:       mock.URL,
+				ClientID:     "client",
+				ClientSecret: "secret",
+			}, "http://api.example.com/oauth/mock/callback")
+
+			state, _ := RandomString()
+			nonce, _ := RandomString()
+			verifier, _ := RandomString()
+
+			code, returnedState := login(t, p, state, nonce, verifier)
+			if returnedState != state {
+				t.Fatalf("state = %q, want %q", returnedState, state)
+			}
+
+			if tt.wrongVerifier {
+				verifier, _ = RandomString()
+			}
+			if tt.wrongNonce {
+				nonce, _ = RandomString()
+			}
+
+			claims, err := p.Exchange(context.Background(), code, verifier, nonce)
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantAnyErr:
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if claims.Subject != "user-1" || claims.Email != "gamer@example.com" || !claims.Verified() {
+					t.Fatalf("unexpected claims %+v", claims)
+				}
+			}
+		})
+	}
+}
+
+func TestCodeCanOnlyBeExchangedOnce(t *testing.T) {
+	mock := newMockProvider(t)
+
+	p := NewProvider(Config{Name: "mock", Issuer: mock.URL, ClientID: "client", ClientSecret: "secret"},
+		"http://api.example.com/oauth/mock/callback")
+
+	code, _ := login(t, p, "state", "nonce", "verifier")
+
+	if _, err := p.Exchange(context.Background(), code, "verifier", "nonce"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(context.Background(), code, "verifier", "nonce"); err == nil {
+		t.Fatal("expected the second exchange to fail")
+	}
+}
+
+func TestVerified(t *testing.T) {
+	tests := []struct {
+		email    string
+		verified string
+		want     bool
+	}{
+		{"a@example.com", `true`, true},
+		{"a@example.com", `"true"`, true},
+		{"a@example.com", `false`, false},
+		{"a@example.com", ``, false},
+		{"", `true`, false},
+	}
+
+	for _, tt := range tests {
+		c := Claims{Email: tt.email, EmailVerified: json.RawMessage(tt.verified)}
+		if got := c.Verified(); got != tt.want {
+			t.Errorf("Verified(%q, %s) = %v, want %v", tt.email, tt.verified, got, tt.want)
+		}
+	}
+}
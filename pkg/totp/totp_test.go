@@ -0,0 +1,84 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors of RFC 6238, appendix B, cut to six digits.
+func TestCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := Code(secret, Step(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: Code(secret, current), wantStep: current, wantOK: true},
+		{name: "previous step", code: Code(secret, current-1), wantStep: current - 1, wantOK: true},
+		{name: "next step", code: Code(secret, current+1), wantStep: current + 1, wantOK: true},
+		{name: "too old", code: Code(secret, current-2)},
+		{name: "too new", code: Code(secret, current+2)},
+		{name: "wrong code", code: "000000"},
+		{name: "replayed", code: Code(secret, current), lastStep: current},
+		{name: "after last step", code: Code(secret, current), lastStep: current - 1, wantStep: current, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(secret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Fatalf("Validate = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	u, err := url.Parse(URI("Game Store", "gamer@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Game Store:gamer@example.com" {
+		t.Fatalf("unexpected uri %s", u)
+	}
+
+	qs := u.Query()
+	if qs.Get("secret") != EncodeSecret(secret) || strings.Contains(qs.Get("secret"), "=") {
+		t.Fatalf("secret = %q", qs.Get("secret"))
+	}
+	if qs.Get("issuer") != "Game Store" || qs.Get("digits") != "6" || qs.Get("period") != "30" {
+		t.Fatalf("unexpected parameters %v", qs)
+	}
+}
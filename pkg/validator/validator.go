@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"net/url"
 	"regexp"
 )
 
@@ -53,4 +54,14 @@ func Unique(values []string) bool {
 	}
 
 	return len(values) == len(uniqueValues)
-}
\ No newline at end of file
+}
+
+// IsURL reports whether value is an absolute http or https URL.
+func IsURL(value string) bool {
+	u, err := url.ParseRequestURI(value)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}